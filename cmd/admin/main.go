@@ -0,0 +1,233 @@
+// Command admin manages the URL shortener's data from the command line
+//
+// Usage:
+//
+//	admin keys create -name NAME [-scopes SCOPE,...] [-user EMAIL]
+//	admin keys list
+//	admin keys revoke PREFIX
+//	admin links disable [-status 410|451] [-reason TEXT] CODE
+//	admin links enable CODE
+//	admin links delete CODE
+//
+// It reads the same environment and .env file as the server
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/apikey"
+	"github.com/ItsDobiel/URLShortener/internal/config"
+	"github.com/ItsDobiel/URLShortener/internal/database"
+	"github.com/ItsDobiel/URLShortener/internal/shortener"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+const usage = `Usage:
+  admin keys create -name NAME [-scopes SCOPE,...] [-user EMAIL]
+  admin keys list
+  admin keys revoke PREFIX
+  admin links disable [-status 410|451] [-reason TEXT] CODE
+  admin links enable CODE
+  admin links delete CODE
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "admin: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command given by args, writing its output to out
+func run(args []string, out io.Writer) error {
+	if len(args) < 2 || args[0] != "keys" && args[0] != "links" {
+		return errors.New("expected a command\n" + usage)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg.DatabaseDriver == "memory" {
+		return errors.New("the memory store only lives inside the server, use sqlite or postgres")
+	}
+
+	db, err := database.Open(cfg.DatabaseDriver, cfg.DatabasePath, cfg.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] + " " + args[1] {
+	case "keys create":
+		return createKey(db, args[2:], out)
+	case "keys list":
+		return listKeys(db, out)
+	case "keys revoke":
+		return revokeKey(db, args[2:], out)
+	case "links disable":
+		return disableLink(db, args[2:], out)
+	case "links enable":
+		return enableLink(db, args[2:], out)
+	case "links delete":
+		return deleteLink(db, args[2:], out)
+	default:
+		return fmt.Errorf("unknown %s command %q\n%s", args[0], args[1], usage)
+	}
+}
+
+// createKey mints a key and prints it, the only time it is ever shown
+func createKey(db store.Store, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the client the key is for")
+	scopes := flags.String("scopes", "*", "comma separated scopes, * for all of "+strings.Join(apikey.AllScopes, ", ")+", or "+apikey.ScopeAdmin+" to manage every link")
+	email := flags.String("user", "", "email of the user whose links the key manages, empty for none")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var userID *uint
+	if *email != "" {
+		user, err := db.FindUserByEmail(strings.ToLower(strings.TrimSpace(*email)))
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("no user with email %q", *email)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up user: %w", err)
+		}
+		userID = &user.ID
+	}
+
+	key, apiKey, err := apikey.Create(db, *name, strings.Split(*scopes, ","), userID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Created API key %s for %s with scopes %s\n", apiKey.Prefix, apiKey.Name, apiKey.Scopes)
+	fmt.Fprintf(out, "\n  %s\n\nStore it now, it can't be shown again\n", key)
+	return nil
+}
+
+// listKeys prints every key, without the secret part
+func listKeys(db store.Store, out io.Writer) error {
+	list, err := db.ListAPIKeys()
+	if err != nil {
+		return fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PREFIX\tNAME\tUSER\tSCOPES\tCREATED\tLAST USED\tREVOKED")
+	for _, key := range list {
+		owner := "-"
+		if key.UserID != nil {
+			if user, err := db.FindUserByID(*key.UserID); err == nil {
+				owner = user.Email
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.Prefix, key.Name, owner, key.Scopes,
+			formatTime(&key.CreatedAt), formatTime(key.LastUsedAt), formatTime(key.RevokedAt))
+	}
+	return w.Flush()
+}
+
+// revokeKey revokes the key with the given prefix
+func revokeKey(keys store.KeyStore, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("expected the prefix of the key to revoke\n" + usage)
+	}
+
+	err := keys.RevokeAPIKey(args[0], time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("no API key with prefix %q", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	fmt.Fprintf(out, "Revoked API key %s\n", args[0])
+	return nil
+}
+
+// disableLink stops a link from redirecting, whoever it belongs to
+func disableLink(links store.LinkStore, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("links disable", flag.ContinueOnError)
+	status := flags.Int("status", 0, "status the link answers with, 410 or 451, 0 for the server default")
+	reason := flags.String("reason", "", "reason shown to visitors, empty for the server default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expected the short code of the link to disable\n" + usage)
+	}
+	if *status != 0 && !shortener.IsDisabledStatus(*status) {
+		return errors.New("status must be 410 or 451")
+	}
+
+	shortCode := flags.Arg(0)
+	err := links.DisableByShortCode(shortCode, time.Now(), *status, strings.TrimSpace(*reason))
+	if err != nil {
+		return linkError("disable", shortCode, err)
+	}
+
+	fmt.Fprintf(out, "Disabled link %s\n", shortCode)
+	return nil
+}
+
+// enableLink lets a disabled link redirect again
+func enableLink(links store.LinkStore, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("expected the short code of the link to enable\n" + usage)
+	}
+
+	if err := links.EnableByShortCode(args[0]); err != nil {
+		return linkError("enable", args[0], err)
+	}
+
+	fmt.Fprintf(out, "Enabled link %s\n", args[0])
+	return nil
+}
+
+// deleteLink deletes a link, whoever it belongs to
+// Its short code stays taken until the sweeper purges it
+func deleteLink(links store.LinkStore, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("expected the short code of the link to delete\n" + usage)
+	}
+
+	urlModel, err := links.FindByShortCode(args[0])
+	if err == nil && urlModel.IsDeleted() {
+		err = store.ErrNotFound
+	}
+	if err == nil {
+		err = links.DeleteByShortCode(args[0])
+	}
+	if err != nil {
+		return linkError("delete", args[0], err)
+	}
+
+	fmt.Fprintf(out, "Deleted link %s\n", args[0])
+	return nil
+}
+
+// linkError describes why an action on a link failed
+func linkError(action, shortCode string, err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("no link with short code %q", shortCode)
+	}
+	return fmt.Errorf("failed to %s link: %w", action, err)
+}
+
+// formatTime prints a timestamp, or - when there is none
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
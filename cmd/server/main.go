@@ -1,17 +1,30 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/ItsDobiel/URLShortener/internal/accounts"
+	"github.com/ItsDobiel/URLShortener/internal/analytics"
+	"github.com/ItsDobiel/URLShortener/internal/apikey"
+	"github.com/ItsDobiel/URLShortener/internal/clientip"
 	"github.com/ItsDobiel/URLShortener/internal/config"
 	"github.com/ItsDobiel/URLShortener/internal/database"
 	"github.com/ItsDobiel/URLShortener/internal/handlers"
+	"github.com/ItsDobiel/URLShortener/internal/logging"
+	"github.com/ItsDobiel/URLShortener/internal/metrics"
+	"github.com/ItsDobiel/URLShortener/internal/normalize"
 	"github.com/ItsDobiel/URLShortener/internal/router"
 	"github.com/ItsDobiel/URLShortener/internal/shortener"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+	"github.com/ItsDobiel/URLShortener/internal/sweeper"
 )
 
 func main() {
@@ -20,55 +33,227 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	if _, err := os.Stat(cfg.DatabasePath); os.IsNotExist(err) {
-		// Directory doesn't exist, create it
-		err := os.MkdirAll(cfg.DatabasePath, 0755)
+	// Everything logged through the log package goes through slog from here on
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	linkStore, err := openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	log.Println("Database initialized successfully")
+
+	// Routes add their own paths to the reserved words in SetupRouter
+	reserved := shortener.NewReservedWords(cfg.ReservedCodes...)
+
+	generator, err := shortener.NewCodeGenerator(cfg.CodeGenerator, cfg.CodeGeneratorSecret)
+	if err != nil {
+		log.Fatalf("Invalid CODE_GENERATOR: %v", err)
+	}
+
+	var network *shortener.NetworkPolicy
+	if cfg.BlockPrivateDestinations {
+		network, err = shortener.NewNetworkPolicy(cfg.AllowedPrivateDestinations, cfg.ResolveDestinations)
 		if err != nil {
-			log.Fatalf("failed to create directory: %v", err)
+			log.Fatalf("Invalid ALLOWED_PRIVATE_DESTINATIONS: %v", err)
 		}
-		log.Printf("Directory created: %s\n", cfg.DatabasePath)
 	}
 
-	if err := database.Initialize(cfg.DatabasePath + "/urlshortener.db"); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	var domains *shortener.DomainPolicy
+	if cfg.DomainRulesFile != "" {
+		domains, err = shortener.LoadDomainPolicy(cfg.DomainRulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load domain rules: %v", err)
+		}
 	}
-	defer func() {
-		if err := database.Close(); err != nil {
-			log.Printf("Error closing database: %v", err)
+
+	normalizeRules, err := normalize.ParseRules(cfg.NormalizeRules)
+	if err != nil {
+		log.Fatalf("Invalid NORMALIZE_RULES: %v", err)
+	}
+	if cfg.StripTrackingParams {
+		normalizeRules.TrackingParams = normalize.DefaultTrackingParams
+		if len(cfg.TrackingParams) > 0 {
+			normalizeRules.TrackingParams = cfg.TrackingParams
 		}
-	}()
+	}
 
-	log.Println("Database initialized successfully")
+	svc := shortener.NewService(linkStore, shortener.Options{
+		CodeLength: cfg.ShortCodeLength,
+		Generator:  generator,
+
+		MaxCodeLength:    cfg.MaxShortCodeLength,
+		CollisionRetries: cfg.CollisionRetries,
+
+		Reserved:   reserved,
+		Network:    network,
+		Domains:    domains,
+		Normalizer: normalize.New(normalizeRules),
 
-	svc := shortener.NewService(cfg.ShortCodeLength)
+		StripTrackingFromOriginal: cfg.StripTrackingFromOriginal,
 
-	handler, err := handlers.NewHandler(svc, cfg)
+		SelfDomains:      append([]string{cfg.ShortDomain}, cfg.AliasDomains...),
+		ResolveSelfLinks: cfg.ResolveSelfLinks,
+	})
+
+	clicks := analytics.NewPipeline(linkStore, analytics.PipelineOptions{
+		QueueSize:     cfg.ClickQueueSize,
+		Workers:       cfg.ClickWorkers,
+		BatchSize:     cfg.ClickBatchSize,
+		FlushInterval: cfg.ClickFlushInterval,
+		SampleRate:    cfg.ClickSampleRate,
+	})
+	ips, err := clientip.NewResolver(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	tracker := analytics.NewTracker(linkStore, clicks, cfg.ClickIPSalt, ips)
+
+	metrics.NewCounterFunc("urlshortener_clicks_sampled_total",
+		"Click events skipped by sampling while the queue was nearly full.",
+		func() float64 { return float64(clicks.Sampled()) })
+	metrics.NewCounterFunc("urlshortener_clicks_dropped_total",
+		"Click events lost because the queue was full or closed.",
+		func() float64 { return float64(clicks.Dropped()) })
+	metrics.NewCounterFunc("urlshortener_clicks_failed_total",
+		"Click events lost because the store rejected them.",
+		func() float64 { return float64(clicks.Failed()) })
+
+	handler, err := handlers.NewHandler(svc, tracker, ips,
+		apikey.NewAuthenticator(linkStore), accounts.NewService(linkStore, cfg.SessionTTL), cfg)
 	if err != nil {
 		log.Fatalf("Failed to create handler: %v", err)
 	}
 
-	mux := router.SetupRouter(handler, cfg.TemplatesDir)
+	// Background workers run until workersCtx is cancelled during shutdown
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	// The sweeper always runs, deleted links and sessions are purged even
+	// when expired links are kept
+	linkSweeper := sweeper.New(linkStore, cfg.ExpirySweepInterval, cfg.ArchiveExpired, cfg.DeletedLinkRetention)
+	workers.Go(func() { linkSweeper.Run(workersCtx) })
+	if cfg.ExpirySweepInterval > 0 {
+		log.Printf("Expired links are swept every %s", cfg.ExpirySweepInterval)
+	}
+
+	if domains != nil {
+		workers.Go(func() { reloadOnHangup(workersCtx, domains) })
+		if cfg.DomainRulesReloadInterval > 0 {
+			workers.Go(func() { domains.Watch(workersCtx, cfg.DomainRulesReloadInterval) })
+		}
+	}
 
 	server := &http.Server{
 		Addr:    cfg.GetAddress(),
-		Handler: mux,
+		Handler: router.SetupRouter(handler, cfg.TemplatesDir, reserved, logger),
 	}
 
+	serverErr := make(chan error, 1)
 	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-		<-sigChan
-
-		log.Println("Shutting down server...")
-		if err := server.Close(); err != nil {
-			log.Printf("Error during server shutdown: %v", err)
-		}
+		log.Printf("Server starting on http://%s", cfg.GetAddress())
+		serverErr <- server.ListenAndServe()
 	}()
 
-	log.Printf("Server starting on http://%s", cfg.GetAddress())
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("Server failed to start: %v", err)
+	case sig := <-sigChan:
+		log.Printf("Received %s, shutting down (grace period %s)", sig, cfg.ShutdownTimeout)
+	}
+
+	// Every phase shares the same grace period
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Fail readiness first so that load balancers stop routing new requests here
+	handler.SetDraining()
+	if cfg.ShutdownDrainDelay > 0 {
+		log.Printf("Readiness check failing, waiting %s for load balancers to notice...", cfg.ShutdownDrainDelay)
+		select {
+		case <-time.After(cfg.ShutdownDrainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	log.Println("Stopping HTTP server, draining in-flight requests...")
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Grace period over, closing remaining connections: %v", err)
+		_ = server.Close()
+	}
+	log.Println("HTTP server stopped")
+
+	log.Println("Stopping background workers...")
+	stopWorkers()
+	if err := waitContext(ctx, &workers); err != nil {
+		log.Printf("Gave up waiting for background workers: %v", err)
+	} else {
+		log.Println("Background workers stopped")
+	}
+
+	log.Println("Flushing click events...")
+	if err := clicks.Close(ctx); err != nil {
+		log.Printf("Error flushing click events: %v", err)
+	}
+	log.Printf("Click events flushed (sampled: %d, dropped: %d, failed: %d)",
+		clicks.Sampled(), clicks.Dropped(), clicks.Failed())
+
+	log.Println("Closing database...")
+	if err := linkStore.Close(); err != nil {
+		log.Printf("Error closing database: %v", err)
+	} else {
+		log.Println("Database closed")
 	}
 
 	log.Println("Server stopped")
 }
+
+// waitContext waits for the wait group, or until ctx is done
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reloadOnHangup reloads the domain rules on every SIGHUP until ctx is done
+func reloadOnHangup(ctx context.Context, domains *shortener.DomainPolicy) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := domains.Reload(); err != nil {
+				log.Printf("Keeping previous domain rules: %v", err)
+			}
+		}
+	}
+}
+
+// openStore creates the store selected by DATABASE_DRIVER
+func openStore(cfg *config.Config) (store.Store, error) {
+	if cfg.DatabaseDriver == "memory" {
+		log.Println("Using in-memory store, links will be lost on restart")
+		return store.NewMemoryStore(), nil
+	}
+	return database.Open(cfg.DatabaseDriver, cfg.DatabasePath, cfg.DatabaseDSN)
+}
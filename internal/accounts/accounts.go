@@ -0,0 +1,152 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+	"github.com/ItsDobiel/URLShortener/internal/tokens"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// minPasswordLength is the shortest password accepted at registration
+	minPasswordLength = 8
+
+	// maxPasswordLength is the longest password bcrypt can hash
+	maxPasswordLength = 72
+)
+
+var (
+	// ErrInvalidEmail is returned when registering with a malformed email
+	ErrInvalidEmail = errors.New("please enter a valid email address")
+
+	// ErrWeakPassword is returned when registering with a password of the wrong length
+	ErrWeakPassword = fmt.Errorf("password must be %d to %d characters long", minPasswordLength, maxPasswordLength)
+
+	// ErrEmailTaken is returned when registering an email twice
+	ErrEmailTaken = errors.New("an account with this email already exists")
+
+	// ErrInvalidCredentials is returned when logging in with a wrong email or password
+	ErrInvalidCredentials = errors.New("invalid email or password")
+
+	// ErrInvalidSession is returned for unknown and expired session tokens
+	ErrInvalidSession = errors.New("session is invalid or has expired")
+)
+
+// dummyHash is compared against when logging in with an unknown email,
+// so that the response time doesn't reveal which emails are registered
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// Service registers users and keeps track of who is logged in
+type Service struct {
+	store      store.UserStore
+	sessionTTL time.Duration
+	now        func() time.Time
+}
+
+// NewService creates an account service whose sessions last sessionTTL
+func NewService(users store.UserStore, sessionTTL time.Duration) *Service {
+	return &Service{store: users, sessionTTL: sessionTTL, now: time.Now}
+}
+
+// Register creates an account
+func (s *Service) Register(email, password string) (*models.User, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return nil, ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &models.User{Email: email, PasswordHash: string(hash)}
+	if err := s.store.CreateUser(user); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("failed to save user: %w", err)
+	}
+	return user, nil
+}
+
+// Login checks a user's password and starts a session
+// It returns the session token to hand to the client and when it expires
+func (s *Service) Login(email, password string) (string, time.Time, error) {
+	user, err := s.store.FindUserByEmail(strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			return "", time.Time{}, fmt.Errorf("failed to look up user: %w", err)
+		}
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	return s.StartSession(user)
+}
+
+// StartSession logs a user in, returning the session token and when it expires
+func (s *Service) StartSession(user *models.User) (string, time.Time, error) {
+	token := rand.Text()
+	session := &models.Session{
+		TokenHash: tokens.Hash(token),
+		UserID:    user.ID,
+		ExpiresAt: s.now().Add(s.sessionTTL),
+	}
+	if err := s.store.CreateSession(session); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to save session: %w", err)
+	}
+	return token, session.ExpiresAt, nil
+}
+
+// Authenticate returns the user logged in with a session token
+func (s *Service) Authenticate(token string) (*models.User, error) {
+	if token == "" {
+		return nil, ErrInvalidSession
+	}
+
+	session, err := s.store.FindSessionByHash(tokens.Hash(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up session: %w", err)
+	}
+	if session.IsExpired(s.now()) {
+		return nil, ErrInvalidSession
+	}
+	return &session.User, nil
+}
+
+// Logout ends the session of a token
+func (s *Service) Logout(token string) error {
+	if token == "" {
+		return nil
+	}
+	return s.store.DeleteSession(tokens.Hash(token))
+}
+
+// normalizeEmail lowercases an email and checks that it is a bare address
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > 254 {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
@@ -0,0 +1,106 @@
+package accounts
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+// newTestService creates a service on an empty in-memory store whose clock reads *now
+func newTestService(sessionTTL time.Duration, now *time.Time) *Service {
+	s := NewService(store.NewMemoryStore(), sessionTTL)
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestRegister(t *testing.T) {
+	now := time.Now()
+	s := newTestService(time.Hour, &now)
+
+	user, err := s.Register(" User@Example.com ", "correct horse")
+	if err != nil || user.Email != "user@example.com" || user.PasswordHash == "correct horse" {
+		t.Fatalf("Register = %+v, %v, want a user with a lowercased email and a hashed password", user, err)
+	}
+
+	tests := []struct {
+		email    string
+		password string
+		want     error
+	}{
+		{"USER@example.com", "another password", ErrEmailTaken},
+		{"not an email", "correct horse", ErrInvalidEmail},
+		{"Name <other@example.com>", "correct horse", ErrInvalidEmail},
+		{"other@example.com", "short", ErrWeakPassword},
+		{"other@example.com", string(make([]byte, maxPasswordLength+1)), ErrWeakPassword},
+	}
+	for _, tt := range tests {
+		if _, err := s.Register(tt.email, tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("Register(%q) = %v, want %v", tt.email, err, tt.want)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	now := time.Now()
+	s := newTestService(time.Hour, &now)
+	if _, err := s.Register("user@example.com", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ email, password string }{
+		{"user@example.com", "wrong horse"},
+		{"user@example.com", "Correct horse"},
+		{"nobody@example.com", "correct horse"},
+	} {
+		if _, _, err := s.Login(tt.email, tt.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Login(%s, %s) = %v, want ErrInvalidCredentials", tt.email, tt.password, err)
+		}
+	}
+
+	token, expiresAt, err := s.Login(" USER@example.com", "correct horse")
+	if err != nil || token == "" || !expiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("Login = %q, %v, %v, want a session lasting an hour", token, expiresAt, err)
+	}
+	if user, err := s.Authenticate(token); err != nil || user.Email != "user@example.com" {
+		t.Errorf("Authenticate = %+v, %v, want the logged in user", user, err)
+	}
+}
+
+func TestSessionLifetime(t *testing.T) {
+	now := time.Now()
+	s := newTestService(time.Hour, &now)
+	user, err := s.Register("user@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := s.StartSession(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour - time.Second)
+	if _, err := s.Authenticate(token); err != nil {
+		t.Errorf("Authenticate just before the session expires = %v", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := s.Authenticate(token); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Authenticate once the session expired = %v, want ErrInvalidSession", err)
+	}
+
+	// Logging out ends a session before it expires
+	token, _, err = s.StartSession(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Logout(token); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{token, "", "unknown"} {
+		if _, err := s.Authenticate(token); !errors.Is(err, ErrInvalidSession) {
+			t.Errorf("Authenticate(%q) = %v, want ErrInvalidSession", token, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package analytics
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ItsDobiel/URLShortener/internal/clientip"
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+const (
+	// maxUserAgentLength matches the size of the user_agent column
+	maxUserAgentLength = 512
+
+	// maxReferrerLength matches the size of the referrer column
+	maxReferrerLength = 255
+)
+
+// Tracker records clicks on short links and reports per-link statistics
+type Tracker struct {
+	store    store.ClickStore
+	pipeline *Pipeline
+	salt     []byte
+	clientIP *clientip.Resolver
+}
+
+// NewTracker creates a tracker that queues clicks on the pipeline and reads
+// statistics from the store
+// The salt is mixed into client IP hashes; when it is empty a random one is
+// used, so hashes can't be correlated across restarts
+func NewTracker(clickStore store.ClickStore, pipeline *Pipeline, salt string, ips *clientip.Resolver) *Tracker {
+	saltBytes := []byte(salt)
+	if len(saltBytes) == 0 {
+		saltBytes = []byte(rand.Text())
+	}
+
+	return &Tracker{
+		store:    clickStore,
+		pipeline: pipeline,
+		salt:     saltBytes,
+		clientIP: ips,
+	}
+}
+
+// Track queues a click on the short code made by the given request
+// It never blocks, so a slow database can't hold up redirects
+func (t *Tracker) Track(r *http.Request, shortCode string) {
+	t.pipeline.Enqueue(t.NewClick(r, shortCode, time.Now()))
+}
+
+// NewClick builds the click event for a request without storing it
+func (t *Tracker) NewClick(r *http.Request, shortCode string, clickedAt time.Time) models.Click {
+	userAgent := truncate(r.UserAgent(), maxUserAgentLength)
+
+	return models.Click{
+		ShortCode: shortCode,
+		ClickedAt: clickedAt.UTC(),
+		Day:       clickedAt.UTC().Format(time.DateOnly),
+		Referrer:  truncate(referrerHost(r.Referer()), maxReferrerLength),
+		UserAgent: userAgent,
+		UAFamily:  UserAgentFamily(userAgent),
+		IPHash:    t.hashIP(t.clientIP.IP(r)),
+	}
+}
+
+// Stats aggregates the clicks of a short link over the last days
+func (t *Tracker) Stats(shortCode string, days, limit int) (*models.ClickStats, error) {
+	since := time.Now().UTC().AddDate(0, 0, -(days - 1))
+	return t.store.ClickStats(shortCode, since, limit)
+}
+
+// hashIP returns the salted SHA-256 of an IP address
+func (t *Tracker) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+
+	hash := sha256.New()
+	hash.Write(t.salt)
+	hash.Write([]byte(ip))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// referrerHost reduces a Referer header to its host
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+
+	parsedURL, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsedURL.Hostname())
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,177 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+// PipelineOptions configures a Pipeline
+type PipelineOptions struct {
+	// QueueSize is how many clicks can wait to be written
+	QueueSize int
+
+	// Workers is the number of goroutines writing batches
+	Workers int
+
+	// BatchSize is the largest number of clicks written at once
+	BatchSize int
+
+	// FlushInterval bounds how long a partial batch waits before being written
+	FlushInterval time.Duration
+
+	// SampleRate keeps one in this many clicks once the queue is three quarters full
+	SampleRate int
+}
+
+// Pipeline queues click events in memory and writes them in batches
+// from background workers, so redirects never wait for the database
+// Under overload clicks are sampled and then dropped, and both are counted
+type Pipeline struct {
+	store store.ClickStore
+	opts  PipelineOptions
+	queue chan models.Click
+
+	// mu guards closed so that Enqueue never sends on a closed queue
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+
+	offered atomic.Uint64
+	sampled atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// NewPipeline creates a pipeline and starts its workers
+// Sizes and counts below one are raised to one, a FlushInterval that is not
+// positive falls back to a second
+func NewPipeline(clickStore store.ClickStore, opts PipelineOptions) *Pipeline {
+	opts.QueueSize = max(opts.QueueSize, 1)
+	opts.Workers = max(opts.Workers, 1)
+	opts.BatchSize = max(opts.BatchSize, 1)
+	opts.SampleRate = max(opts.SampleRate, 1)
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	p := &Pipeline{
+		store: clickStore,
+		opts:  opts,
+		queue: make(chan models.Click, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+
+	var workers sync.WaitGroup
+	for range opts.Workers {
+		workers.Go(p.work)
+	}
+	go func() {
+		workers.Wait()
+		close(p.done)
+	}()
+
+	return p
+}
+
+// Enqueue hands a click to the workers without blocking
+// It returns false when the click was sampled out, dropped because the
+// queue is full, or the pipeline is closed
+func (p *Pipeline) Enqueue(click models.Click) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+
+	// Past the high-water mark only every SampleRate-th click is kept
+	n := p.offered.Add(1)
+	if len(p.queue) >= cap(p.queue)*3/4 && n%uint64(p.opts.SampleRate) != 0 {
+		p.sampled.Add(1)
+		return false
+	}
+
+	select {
+	case p.queue <- click:
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Close stops accepting clicks and waits until the queued ones are written
+// It gives up when ctx is done, losing whatever is still queued
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sampled returns how many clicks were skipped by sampling
+func (p *Pipeline) Sampled() uint64 {
+	return p.sampled.Load()
+}
+
+// Dropped returns how many clicks were lost because the queue was full or closed
+func (p *Pipeline) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+// Failed returns how many clicks were lost because the store rejected them
+func (p *Pipeline) Failed() uint64 {
+	return p.failed.Load()
+}
+
+// work collects clicks into batches until the queue is closed and drained
+func (p *Pipeline) work() {
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.Click, 0, p.opts.BatchSize)
+	for {
+		select {
+		case click, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= p.opts.BatchSize {
+				batch = p.flush(batch)
+			}
+		case <-ticker.C:
+			batch = p.flush(batch)
+		}
+	}
+}
+
+// flush writes a batch and returns it emptied for reuse
+func (p *Pipeline) flush(batch []models.Click) []models.Click {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := p.store.RecordClicks(batch); err != nil {
+		p.failed.Add(uint64(len(batch)))
+		log.Printf("Failed to record %d clicks: %v", len(batch), err)
+	}
+	return batch[:0]
+}
@@ -0,0 +1,165 @@
+package analytics
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+)
+
+// recordingStore keeps the batches written to it
+// When release is set every write first signals entered and then waits on it
+type recordingStore struct {
+	mu      sync.Mutex
+	batches [][]models.Click
+	written chan struct{}
+
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newRecordingStore() *recordingStore {
+	return &recordingStore{written: make(chan struct{}, 100)}
+}
+
+func (s *recordingStore) RecordClicks(clicks []models.Click) error {
+	if s.release != nil {
+		s.entered <- struct{}{}
+		<-s.release
+	}
+
+	s.mu.Lock()
+	s.batches = append(s.batches, slices.Clone(clicks))
+	s.mu.Unlock()
+	s.written <- struct{}{}
+	return nil
+}
+
+func (s *recordingStore) ClickStats(string, time.Time, int) (*models.ClickStats, error) {
+	return &models.ClickStats{}, nil
+}
+
+// sizes returns the size of every batch written so far
+func (s *recordingStore) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sizes []int
+	for _, batch := range s.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+// waitForBatch fails the test unless a batch is written within a second
+func (s *recordingStore) waitForBatch(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-s.written:
+	case <-time.After(time.Second):
+		t.Fatalf("no batch written, got %v so far", s.sizes())
+	}
+}
+
+func closePipeline(t *testing.T, p *Pipeline) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Close(ctx); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+}
+
+func TestPipelineWritesFullBatches(t *testing.T) {
+	clicks := newRecordingStore()
+	p := NewPipeline(clicks, PipelineOptions{QueueSize: 100, Workers: 1, BatchSize: 3, FlushInterval: time.Hour, SampleRate: 1})
+
+	for range 7 {
+		if !p.Enqueue(models.Click{ShortCode: "abcd123"}) {
+			t.Fatal("Enqueue refused a click into an empty queue")
+		}
+	}
+	clicks.waitForBatch(t)
+	clicks.waitForBatch(t)
+	if got := clicks.sizes(); !slices.Equal(got, []int{3, 3}) {
+		t.Fatalf("batches before Close = %v, want two full ones", got)
+	}
+
+	// Close writes the partial batch left over
+	closePipeline(t, p)
+	if got := clicks.sizes(); !slices.Equal(got, []int{3, 3, 1}) {
+		t.Errorf("batches after Close = %v, want the last click written too", got)
+	}
+	if p.Sampled() != 0 || p.Dropped() != 0 || p.Failed() != 0 {
+		t.Errorf("sampled %d, dropped %d, failed %d, want none", p.Sampled(), p.Dropped(), p.Failed())
+	}
+}
+
+func TestPipelineFlushesOnInterval(t *testing.T) {
+	clicks := newRecordingStore()
+	p := NewPipeline(clicks, PipelineOptions{QueueSize: 100, Workers: 1, BatchSize: 100, FlushInterval: 10 * time.Millisecond, SampleRate: 1})
+	defer closePipeline(t, p)
+
+	p.Enqueue(models.Click{ShortCode: "abcd123"})
+	p.Enqueue(models.Click{ShortCode: "abcd123"})
+	clicks.waitForBatch(t)
+	if got := clicks.sizes(); !slices.Equal(got, []int{2}) {
+		t.Errorf("batches = %v, want the partial batch flushed by the ticker", got)
+	}
+}
+
+func TestPipelineSamplesAndDropsUnderLoad(t *testing.T) {
+	clicks := newRecordingStore()
+	clicks.entered = make(chan struct{})
+	clicks.release = make(chan struct{})
+	p := NewPipeline(clicks, PipelineOptions{QueueSize: 8, Workers: 1, BatchSize: 1, FlushInterval: time.Hour, SampleRate: 2})
+
+	// Hold the only worker in the store so that the queue fills up
+	p.Enqueue(models.Click{ShortCode: "abcd123"})
+	<-clicks.entered
+
+	// Six clicks fill the queue to its high-water mark, past it every
+	// second click is sampled out until the queue is full
+	var accepted int
+	for range 11 {
+		if p.Enqueue(models.Click{ShortCode: "abcd123"}) {
+			accepted++
+		}
+	}
+	if accepted != 8 || p.Sampled() != 2 || p.Dropped() != 1 {
+		t.Errorf("accepted %d, sampled %d, dropped %d, want 8, 2 and 1", accepted, p.Sampled(), p.Dropped())
+	}
+
+	// Close drains everything that was queued
+	go func() {
+		for range clicks.entered {
+			clicks.release <- struct{}{}
+		}
+	}()
+	clicks.release <- struct{}{}
+	closePipeline(t, p)
+	close(clicks.entered)
+	if got := len(clicks.sizes()); got != 9 {
+		t.Errorf("wrote %d clicks, want the held one and the 8 queued", got)
+	}
+
+	if p.Enqueue(models.Click{ShortCode: "abcd123"}) || p.Dropped() != 2 {
+		t.Errorf("Enqueue after Close accepted the click or didn't count it, dropped %d", p.Dropped())
+	}
+}
+
+func TestPipelineRaisesZeroOptions(t *testing.T) {
+	clicks := newRecordingStore()
+	p := NewPipeline(clicks, PipelineOptions{})
+
+	if !p.Enqueue(models.Click{ShortCode: "abcd123"}) {
+		t.Fatal("Enqueue refused a click with zero options")
+	}
+	clicks.waitForBatch(t)
+	closePipeline(t, p)
+}
@@ -0,0 +1,40 @@
+package analytics
+
+import "strings"
+
+// userAgentFamilies maps a User-Agent substring to a family name
+// Order matters: many browsers include the tokens of the ones they derive from,
+// Edge and Opera claim to be Chrome and Chrome claims to be Safari
+var userAgentFamilies = []struct {
+	token  string
+	family string
+}{
+	{"bot", "Bot"},
+	{"spider", "Bot"},
+	{"crawl", "Bot"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+	{"go-http-client", "Go"},
+	{"python-requests", "Python"},
+	{"edg/", "Edge"},
+	{"opr/", "Opera"},
+	{"firefox/", "Firefox"},
+	{"chrome/", "Chrome"},
+	{"chromium/", "Chrome"},
+	{"safari/", "Safari"},
+}
+
+// UserAgentFamily classifies a User-Agent header into a browser or client family
+func UserAgentFamily(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown"
+	}
+
+	lower := strings.ToLower(userAgent)
+	for _, candidate := range userAgentFamilies {
+		if strings.Contains(lower, candidate.token) {
+			return candidate.family
+		}
+	}
+	return "Other"
+}
@@ -0,0 +1,175 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+	"github.com/ItsDobiel/URLShortener/internal/tokens"
+)
+
+// Scopes an API key can be granted
+const (
+	ScopeLinksCreate = "links:create"
+	ScopeLinksRead   = "links:read"
+	ScopeLinksUpdate = "links:update"
+	ScopeLinksDelete = "links:delete"
+	ScopeStatsRead   = "stats:read"
+
+	// ScopeAdmin lets a key manage every link, whoever it belongs to
+	// It is only granted when asked for by name, and brings every other scope
+	ScopeAdmin = "admin"
+)
+
+// AllScopes lists every scope
+var AllScopes = []string{ScopeLinksCreate, ScopeLinksRead, ScopeLinksUpdate, ScopeLinksDelete, ScopeStatsRead}
+
+// AnonymousScopes are the scopes requests without a key get while keys
+// aren't required: links can be created and read, but never changed
+var AnonymousScopes = []string{ScopeLinksCreate, ScopeLinksRead, ScopeStatsRead}
+
+// keyPrefix starts every key, so that leaked keys are easy to recognise
+const keyPrefix = "usk_"
+
+// visiblePrefixLength is how much of a key is stored in the clear
+const visiblePrefixLength = 12
+
+// createAttempts bounds how many keys Create mints before giving up on
+// finding one whose visible prefix is free
+const createAttempts = 3
+
+// touchInterval bounds how often the last used time of a key is written
+const touchInterval = time.Minute
+
+var (
+	// ErrInvalidKey is returned for keys that were never minted
+	ErrInvalidKey = errors.New("invalid API key")
+
+	// ErrRevokedKey is returned for keys that have been revoked
+	ErrRevokedKey = errors.New("API key has been revoked")
+)
+
+// Generate mints a new API key
+// The key is only ever returned here, the store keeps its hash
+func Generate(name string, scopes []string) (string, *models.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, errors.New("API key name is required")
+	}
+	scopes, err := ParseScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := keyPrefix + rand.Text()
+	return key, &models.APIKey{
+		Name:    name,
+		Prefix:  key[:visiblePrefixLength],
+		KeyHash: tokens.Hash(key),
+		Scopes:  strings.Join(scopes, ","),
+	}, nil
+}
+
+// Create mints a key with Generate and saves it, minting another when the
+// visible prefix is already taken by an older key
+// userID is the user whose links the key manages, nil for none
+func Create(keys store.KeyStore, name string, scopes []string, userID *uint) (string, *models.APIKey, error) {
+	for range createAttempts {
+		key, apiKey, err := Generate(name, scopes)
+		if err != nil {
+			return "", nil, err
+		}
+		apiKey.UserID = userID
+
+		err = keys.CreateAPIKey(apiKey)
+		if err == nil {
+			return key, apiKey, nil
+		}
+		if !errors.Is(err, store.ErrConflict) {
+			return "", nil, fmt.Errorf("failed to save API key: %w", err)
+		}
+	}
+	return "", nil, fmt.Errorf("failed to mint an API key with a unique prefix after %d attempts", createAttempts)
+}
+
+// ParseScopes checks scope names, removing duplicates
+// An empty list or "*" grants every scope but admin, and admin grants them all
+func ParseScopes(names []string) ([]string, error) {
+	if len(names) == 0 || len(names) == 1 && names[0] == "*" {
+		return AllScopes, nil
+	}
+
+	var scopes []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == ScopeAdmin {
+			return append(slices.Clone(AllScopes), ScopeAdmin), nil
+		}
+		if !slices.Contains(AllScopes, name) {
+			return nil, fmt.Errorf("unknown scope %q, must be one of %s or %s",
+				name, strings.Join(AllScopes, ", "), ScopeAdmin)
+		}
+		if !slices.Contains(scopes, name) {
+			scopes = append(scopes, name)
+		}
+	}
+	return scopes, nil
+}
+
+// Authenticator checks the API keys sent by clients
+type Authenticator struct {
+	store store.KeyStore
+}
+
+// NewAuthenticator creates an authenticator backed by keys
+func NewAuthenticator(keys store.KeyStore) *Authenticator {
+	return &Authenticator{store: keys}
+}
+
+// Authenticate returns the stored API key matching key
+// Its last used time is updated at most once per touchInterval
+func (a *Authenticator) Authenticate(key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	apiKey, err := a.store.FindAPIKeyByHash(tokens.Hash(key))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+	if apiKey.IsRevoked() {
+		return nil, ErrRevokedKey
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= touchInterval {
+		if err := a.store.TouchAPIKey(apiKey.ID, now); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", apiKey.Prefix, err)
+		}
+		apiKey.LastUsedAt = &now
+	}
+	return apiKey, nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated key
+func NewContext(ctx context.Context, key *models.APIKey) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns the authenticated key of a request, nil for anonymous ones
+func FromContext(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(contextKey{}).(*models.APIKey)
+	return key
+}
@@ -0,0 +1,144 @@
+package apikey
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{nil, AllScopes},
+		{[]string{"*"}, AllScopes},
+		{[]string{" Links:Read ", "links:read", "stats:read"}, []string{ScopeLinksRead, ScopeStatsRead}},
+		{[]string{"links:read", "admin"}, append(slices.Clone(AllScopes), ScopeAdmin)},
+	}
+	for _, tt := range tests {
+		got, err := ParseScopes(tt.names)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("ParseScopes(%q) = %v, %v, want %v", tt.names, got, err, tt.want)
+		}
+	}
+
+	for _, names := range [][]string{{"links:write"}, {"links:read", ""}, {"*", "admin"}} {
+		if _, err := ParseScopes(names); err == nil {
+			t.Errorf("ParseScopes(%q) succeeded, want an error", names)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	_, admin, err := Generate("admin", []string{ScopeAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, all, err := Generate("all", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reader, err := Generate("reader", []string{ScopeLinksRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scope := range AllScopes {
+		if !admin.HasScope(scope) || !all.HasScope(scope) {
+			t.Errorf("admin and * keys lack %s", scope)
+		}
+		if reader.HasScope(scope) != (scope == ScopeLinksRead) {
+			t.Errorf("links:read key has %s = %v", scope, reader.HasScope(scope))
+		}
+	}
+	if !admin.HasScope(ScopeAdmin) || all.HasScope(ScopeAdmin) {
+		t.Error("admin is only granted when asked for by name")
+	}
+
+	// Requests without a key may create and read links, never change them
+	for _, scope := range AnonymousScopes {
+		if !slices.Contains(AllScopes, scope) {
+			t.Errorf("anonymous scope %s is unknown", scope)
+		}
+	}
+	for _, scope := range []string{ScopeLinksUpdate, ScopeLinksDelete, ScopeAdmin} {
+		if slices.Contains(AnonymousScopes, scope) {
+			t.Errorf("anonymous requests get %s", scope)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := store.NewMemoryStore()
+	key, apiKey, err := Create(keys, "client", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, apiKey.Prefix) || apiKey.KeyHash == key || strings.Contains(apiKey.KeyHash, key) {
+		t.Fatalf("minted %q as %+v, want only its prefix and hash stored", key, apiKey)
+	}
+
+	a := NewAuthenticator(keys)
+	found, err := a.Authenticate(key)
+	if err != nil || found.ID != apiKey.ID || found.LastUsedAt == nil {
+		t.Fatalf("Authenticate = %+v, %v, want the key with its use recorded", found, err)
+	}
+
+	for _, other := range []string{"", "usk_", key + "x", strings.TrimPrefix(key, keyPrefix)} {
+		if _, err := a.Authenticate(other); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Authenticate(%q) = %v, want ErrInvalidKey", other, err)
+		}
+	}
+
+	if err := keys.RevokeAPIKey(apiKey.Prefix, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(key); !errors.Is(err, ErrRevokedKey) {
+		t.Errorf("Authenticate of a revoked key = %v, want ErrRevokedKey", err)
+	}
+}
+
+// conflictingKeyStore refuses the first keys it is given as if their
+// prefix were taken
+type conflictingKeyStore struct {
+	*store.MemoryStore
+	conflicts int
+	prefixes  []string
+}
+
+func (s *conflictingKeyStore) CreateAPIKey(key *models.APIKey) error {
+	s.prefixes = append(s.prefixes, key.Prefix)
+	if len(s.prefixes) <= s.conflicts {
+		return store.ErrConflict
+	}
+	return s.MemoryStore.CreateAPIKey(key)
+}
+
+func TestCreateRetriesTakenPrefixes(t *testing.T) {
+	userID := uint(7)
+	keys := &conflictingKeyStore{MemoryStore: store.NewMemoryStore(), conflicts: createAttempts - 1}
+	key, apiKey, err := Create(keys, "client", []string{ScopeLinksRead}, &userID)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	if len(keys.prefixes) != createAttempts || apiKey.Prefix != keys.prefixes[createAttempts-1] {
+		t.Errorf("tried prefixes %v, saved %s", keys.prefixes, apiKey.Prefix)
+	}
+	if found, err := NewAuthenticator(keys).Authenticate(key); err != nil || found.UserID == nil || *found.UserID != userID {
+		t.Errorf("Authenticate = %+v, %v, want the key of user %d", found, err, userID)
+	}
+
+	keys = &conflictingKeyStore{MemoryStore: store.NewMemoryStore(), conflicts: createAttempts}
+	if _, _, err := Create(keys, "client", nil, nil); err == nil {
+		t.Error("Create succeeded although every prefix was taken")
+	}
+	if _, _, err := Create(store.NewMemoryStore(), " ", nil, nil); err == nil {
+		t.Error("Create succeeded without a name")
+	}
+}
@@ -0,0 +1,82 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver finds the IP address of the client behind a request
+// X-Forwarded-For is only believed when the request came through a trusted proxy
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver creates a resolver trusting the given proxies, each an IP
+// address or a CIDR range such as 10.0.0.0/8
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, proxy := range trustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: must be an IP address or CIDR range", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r, nil
+}
+
+// IP returns the client IP of a request
+// X-Forwarded-For is read from right to left, skipping trusted proxies, so
+// that a client can't pick its own address by sending the header itself
+func (r *Resolver) IP(req *http.Request) string {
+	ip := peerIP(req)
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !r.isTrusted(addr) {
+		return ip
+	}
+
+	hops := req.Header.Values("X-Forwarded-For")
+	for i := len(hops) - 1; i >= 0; i-- {
+		list := strings.Split(hops[i], ",")
+		for j := len(list) - 1; j >= 0; j-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(list[j]))
+			if err != nil {
+				// Nothing left of a malformed entry can be trusted
+				return ip
+			}
+			ip = hop.Unmap().String()
+			if !r.isTrusted(hop) {
+				return ip
+			}
+		}
+	}
+	return ip
+}
+
+// isTrusted reports whether addr belongs to a trusted proxy
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIP returns the IP of the peer that sent the request
+func peerIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,52 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolverIP(t *testing.T) {
+	r, err := NewResolver([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		peer   string
+		header []string
+		want   string
+	}{
+		{"no header", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"header from an untrusted peer", "203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"header from a trusted proxy", "10.1.2.3:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted single address", "192.0.2.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted IPv6 proxy", "[2001:db8::1]:1234", []string{"2001:db8:ffff::1, 198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without a header", "10.1.2.3:1234", nil, "10.1.2.3"},
+		{"spoofed left-most hop", "10.1.2.3:1234", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:1234", []string{"198.51.100.1, 10.9.9.9, 10.8.8.8"}, "198.51.100.1"},
+		{"several headers", "10.1.2.3:1234", []string{"1.1.1.1", "198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"only trusted hops", "10.1.2.3:1234", []string{"10.9.9.9, 10.8.8.8"}, "10.9.9.9"},
+		{"malformed hop", "10.1.2.3:1234", []string{"1.1.1.1, not-an-ip, 10.9.9.9"}, "10.9.9.9"},
+		{"IPv4-mapped hop", "10.1.2.3:1234", []string{"::ffff:198.51.100.1"}, "198.51.100.1"},
+		{"IPv4-mapped trusted peer", "[::ffff:10.1.2.3]:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.peer
+		for _, value := range tt.header {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		if got := r.IP(req); got != tt.want {
+			t.Errorf("%s: IP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewResolverRejectsInvalidProxies(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "proxy.example.com", ""} {
+		if _, err := NewResolver([]string{proxy}); err == nil {
+			t.Errorf("NewResolver(%q) succeeded, want an error", proxy)
+		}
+	}
+}
@@ -4,17 +4,115 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// defaultNormalizeRules enables every URL normalization rule
+const defaultNormalizeRules = "lowercase,idn,default_port,percent_encoding,dot_segments,trailing_slash,sort_query"
+
 type Config struct {
 	ServerPort      string
 	ServerHost      string
 	ShortDomain     string
+	DatabaseDriver  string
 	DatabasePath    string
+	DatabaseDSN     string
 	ShortCodeLength int
+	ReservedCodes   []string
 	TemplatesDir    string
+
+	// Short codes grow up to MaxShortCodeLength once CollisionRetries codes
+	// of a length were all taken
+	MaxShortCodeLength int
+	CollisionRetries   int
+
+	// CodeGenerator picks how short codes are made: hash, random, counter or obfuscated
+	CodeGenerator string
+	// CodeGeneratorSecret keys the obfuscated generator
+	CodeGeneratorSecret string
+
+	// NormalizeRules are the URL normalization rules applied for duplicate detection
+	NormalizeRules []string
+
+	// StripTrackingParams removes TrackingParams before duplicate detection
+	StripTrackingParams bool
+	// TrackingParams overrides the default list of tracking parameters
+	TrackingParams []string
+	// StripTrackingFromOriginal removes them from the stored destination as well
+	StripTrackingFromOriginal bool
+
+	// AliasDomains are further hosts that serve the same short links
+	AliasDomains []string
+	// ResolveSelfLinks replaces links to our own short links by their destination instead of rejecting them
+	ResolveSelfLinks bool
+
+	// LogLevel is the lowest level logged: debug, info, warn or error
+	LogLevel string
+	// LogFormat selects json or text log lines
+	LogFormat string
+
+	// ShutdownTimeout is the grace period for in-flight requests and workers on shutdown
+	ShutdownTimeout time.Duration
+	// ShutdownDrainDelay is how long /readyz fails before the server stops accepting connections
+	ShutdownDrainDelay time.Duration
+
+	// DefaultRedirectStatus is used by links that don't set their own
+	DefaultRedirectStatus int
+
+	// ExpirySweepInterval is how often expired links are removed, 0 keeps them
+	// Deleted links and expired sessions are purged either way
+	ExpirySweepInterval time.Duration
+	// ArchiveExpired keeps a copy of swept links in the archive table
+	ArchiveExpired bool
+	// DeletedLinkRetention is how long deleted links keep their short code before they are purged
+	DeletedLinkRetention time.Duration
+
+	// DisabledLinkStatus is answered by disabled links that don't set their own, 410 or 451
+	DisabledLinkStatus int
+	// DisabledLinkMessage is shown by disabled links that don't give a reason
+	DisabledLinkMessage string
+
+	// BlockPrivateDestinations rejects links to loopback, private and other internal addresses
+	BlockPrivateDestinations bool
+	// AllowedPrivateDestinations are hosts, IPs and CIDR ranges exempt from that check
+	AllowedPrivateDestinations []string
+	// ResolveDestinations looks up destination host names to check their addresses
+	ResolveDestinations bool
+
+	// DomainRulesFile holds allow and deny rules for destination hosts, empty for none
+	DomainRulesFile string
+	// DomainRulesReloadInterval is how often the rules file is checked for changes, 0 disables it
+	DomainRulesReloadInterval time.Duration
+
+	// SessionTTL is how long users stay logged in
+	SessionTTL time.Duration
+	// SecureCookies marks session cookies as HTTPS only
+	SecureCookies bool
+
+	// RequireAPIKeys rejects API requests that don't carry an API key
+	RequireAPIKeys bool
+
+	// TrustedProxies are the IPs and CIDR ranges whose X-Forwarded-For is believed
+	TrustedProxies []string
+
+	// Rate limits are per client per minute, 0 disables the limit
+	ShortenRateLimit  int
+	ShortenRateBurst  int
+	RedirectRateLimit int
+	RedirectRateBurst int
+
+	// ClickIPSalt is mixed into the hashed client IPs of click events
+	ClickIPSalt string
+	// Click events are queued and written in batches by background workers
+	ClickQueueSize     int
+	ClickWorkers       int
+	ClickBatchSize     int
+	ClickFlushInterval time.Duration
+	// ClickSampleRate keeps one in this many clicks while the queue is nearly full
+	ClickSampleRate int
 }
 
 // Load reads configuration from environment variables
@@ -23,11 +121,48 @@ func Load() (*Config, error) {
 	_ = godotenv.Load()
 
 	config := &Config{
-		ServerPort:   getEnv("SERVER_PORT", "8080"),
-		ServerHost:   getEnv("SERVER_HOST", "localhost"),
-		ShortDomain:  getEnv("SHORT_DOMAIN", "localhost:8080"),
-		DatabasePath: getEnv("DATABASE_PATH", "./database"),
-		TemplatesDir: getEnv("TEMPLATES_DIR", "templates"),
+		ServerPort:     getEnv("SERVER_PORT", "8080"),
+		ServerHost:     getEnv("SERVER_HOST", "localhost"),
+		ShortDomain:    getEnv("SHORT_DOMAIN", "localhost:8080"),
+		DatabaseDriver: getEnv("DATABASE_DRIVER", "sqlite"),
+		DatabasePath:   getEnv("DATABASE_PATH", "./database"),
+		DatabaseDSN:    getEnv("DATABASE_DSN", ""),
+		TemplatesDir:   getEnv("TEMPLATES_DIR", "templates"),
+		ReservedCodes:  getEnvList("RESERVED_CODES", "admin,health"),
+		AliasDomains:   getEnvList("ALIAS_DOMAINS", ""),
+		NormalizeRules: getEnvList("NORMALIZE_RULES", defaultNormalizeRules),
+		TrackingParams: getEnvList("TRACKING_PARAMS", ""),
+		ClickIPSalt:    getEnv("CLICK_IP_SALT", ""),
+		TrustedProxies: getEnvList("TRUSTED_PROXIES", ""),
+
+		AllowedPrivateDestinations: getEnvList("ALLOWED_PRIVATE_DESTINATIONS", ""),
+		DomainRulesFile:            getEnv("DOMAIN_RULES_FILE", ""),
+		CodeGenerator:              strings.ToLower(getEnv("CODE_GENERATOR", "hash")),
+		CodeGeneratorSecret:        getEnv("CODE_GENERATOR_SECRET", ""),
+		LogLevel:                   strings.ToLower(getEnv("LOG_LEVEL", "info")),
+		LogFormat:                  strings.ToLower(getEnv("LOG_FORMAT", "json")),
+	}
+
+	switch config.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return nil, fmt.Errorf("invalid LOG_LEVEL: must be debug, info, warn or error")
+	}
+
+	switch config.LogFormat {
+	case "json", "text":
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT: must be json or text")
+	}
+
+	switch config.DatabaseDriver {
+	case "sqlite", "memory":
+	case "postgres":
+		if config.DatabaseDSN == "" {
+			return nil, fmt.Errorf("DATABASE_DSN is required when DATABASE_DRIVER is postgres")
+		}
+	default:
+		return nil, fmt.Errorf("invalid DATABASE_DRIVER: must be sqlite, postgres or memory")
 	}
 
 	lengthStr := getEnv("SHORT_CODE_LENGTH", "7")
@@ -37,6 +172,139 @@ func Load() (*Config, error) {
 	}
 	config.ShortCodeLength = length
 
+	if config.MaxShortCodeLength, err = getEnvInt("SHORT_CODE_MAX_LENGTH", 12, length, 20); err != nil {
+		return nil, err
+	}
+	if config.CollisionRetries, err = getEnvInt("COLLISION_RETRIES", 5, 1, 100); err != nil {
+		return nil, err
+	}
+
+	switch config.CodeGenerator {
+	case "hash", "random", "counter":
+	case "obfuscated":
+		if config.CodeGeneratorSecret == "" {
+			return nil, fmt.Errorf("CODE_GENERATOR_SECRET is required when CODE_GENERATOR is obfuscated")
+		}
+	default:
+		return nil, fmt.Errorf("invalid CODE_GENERATOR: must be hash, random, counter or obfuscated")
+	}
+
+	if config.ShutdownTimeout, err = getEnvDuration("SHUTDOWN_TIMEOUT", "15s"); err != nil {
+		return nil, err
+	}
+
+	if config.ShutdownDrainDelay, err = getEnvDuration("SHUTDOWN_DRAIN_DELAY", "0s"); err != nil {
+		return nil, err
+	}
+
+	if config.DefaultRedirectStatus, err = getEnvInt("DEFAULT_REDIRECT_STATUS", 302, 301, 308); err != nil {
+		return nil, err
+	}
+	switch config.DefaultRedirectStatus {
+	case 301, 302, 307, 308:
+	default:
+		return nil, fmt.Errorf("invalid DEFAULT_REDIRECT_STATUS: must be 301, 302, 307 or 308")
+	}
+
+	if config.ExpirySweepInterval, err = getEnvDuration("EXPIRY_SWEEP_INTERVAL", "1h"); err != nil {
+		return nil, err
+	}
+
+	switch action := getEnv("EXPIRED_LINK_ACTION", "purge"); action {
+	case "purge", "archive":
+		config.ArchiveExpired = action == "archive"
+	default:
+		return nil, fmt.Errorf("invalid EXPIRED_LINK_ACTION: must be purge or archive")
+	}
+
+	if config.DeletedLinkRetention, err = getEnvDuration("DELETED_LINK_RETENTION", "720h"); err != nil {
+		return nil, err
+	}
+	if config.DeletedLinkRetention < 0 {
+		return nil, fmt.Errorf("invalid DELETED_LINK_RETENTION: must not be negative")
+	}
+
+	if config.DisabledLinkStatus, err = getEnvInt("DISABLED_LINK_STATUS", 410, 410, 451); err != nil {
+		return nil, err
+	}
+	switch config.DisabledLinkStatus {
+	case 410, 451:
+	default:
+		return nil, fmt.Errorf("invalid DISABLED_LINK_STATUS: must be 410 or 451")
+	}
+	config.DisabledLinkMessage = getEnv("DISABLED_LINK_MESSAGE", "This link has been disabled")
+
+	if config.StripTrackingParams, err = getEnvBool("STRIP_TRACKING_PARAMS", true); err != nil {
+		return nil, err
+	}
+	if config.StripTrackingFromOriginal, err = getEnvBool("STRIP_TRACKING_FROM_ORIGINAL", false); err != nil {
+		return nil, err
+	}
+
+	switch mode := getEnv("SELF_LINK_MODE", "reject"); mode {
+	case "reject", "resolve":
+		config.ResolveSelfLinks = mode == "resolve"
+	default:
+		return nil, fmt.Errorf("invalid SELF_LINK_MODE: must be reject or resolve")
+	}
+
+	if config.BlockPrivateDestinations, err = getEnvBool("BLOCK_PRIVATE_DESTINATIONS", true); err != nil {
+		return nil, err
+	}
+	if config.ResolveDestinations, err = getEnvBool("RESOLVE_DESTINATIONS", true); err != nil {
+		return nil, err
+	}
+
+	if config.DomainRulesReloadInterval, err = getEnvDuration("DOMAIN_RULES_RELOAD_INTERVAL", "30s"); err != nil {
+		return nil, err
+	}
+
+	if config.RequireAPIKeys, err = getEnvBool("REQUIRE_API_KEYS", false); err != nil {
+		return nil, err
+	}
+
+	if config.SessionTTL, err = getEnvDuration("SESSION_TTL", "720h"); err != nil {
+		return nil, err
+	}
+	if config.SessionTTL <= 0 {
+		return nil, fmt.Errorf("invalid SESSION_TTL: must be greater than zero")
+	}
+	if config.SecureCookies, err = getEnvBool("SECURE_COOKIES", false); err != nil {
+		return nil, err
+	}
+
+	if config.ShortenRateLimit, err = getEnvInt("SHORTEN_RATE_LIMIT", 30, 0, 1<<20); err != nil {
+		return nil, err
+	}
+	if config.ShortenRateBurst, err = getEnvInt("SHORTEN_RATE_BURST", 30, 1, 1<<20); err != nil {
+		return nil, err
+	}
+	if config.RedirectRateLimit, err = getEnvInt("REDIRECT_RATE_LIMIT", 600, 0, 1<<20); err != nil {
+		return nil, err
+	}
+	if config.RedirectRateBurst, err = getEnvInt("REDIRECT_RATE_BURST", 100, 1, 1<<20); err != nil {
+		return nil, err
+	}
+
+	if config.ClickQueueSize, err = getEnvInt("CLICK_QUEUE_SIZE", 1024, 1, 1<<20); err != nil {
+		return nil, err
+	}
+	if config.ClickWorkers, err = getEnvInt("CLICK_WORKERS", 2, 1, 64); err != nil {
+		return nil, err
+	}
+	if config.ClickBatchSize, err = getEnvInt("CLICK_BATCH_SIZE", 100, 1, 10000); err != nil {
+		return nil, err
+	}
+	if config.ClickFlushInterval, err = getEnvDuration("CLICK_FLUSH_INTERVAL", "1s"); err != nil {
+		return nil, err
+	}
+	if config.ClickFlushInterval == 0 {
+		return nil, fmt.Errorf("invalid CLICK_FLUSH_INTERVAL: must be greater than zero")
+	}
+	if config.ClickSampleRate, err = getEnvInt("CLICK_SAMPLE_RATE", 10, 1, 1000); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
@@ -45,11 +313,68 @@ func (c *Config) GetAddress() string {
 	return fmt.Sprintf("%s:%s", c.ServerHost, c.ServerPort)
 }
 
+// RedirectStatus returns the status code a link redirects with
+// A zero linkStatus means the link uses the configured default
+func (c *Config) RedirectStatus(linkStatus int) int {
+	if linkStatus != 0 {
+		return linkStatus
+	}
+	return c.DefaultRedirectStatus
+}
+
+// DisabledStatus returns the status code a disabled link answers with
+// The link's own status code wins over the default
+func (c *Config) DisabledStatus(linkStatus int) int {
+	if linkStatus != 0 {
+		return linkStatus
+	}
+	return c.DisabledLinkStatus
+}
+
 // GetShortURL constructs the full short URL from a short code
 func (c *Config) GetShortURL(shortCode string) string {
 	return fmt.Sprintf("http://%s/%s", c.ShortDomain, shortCode)
 }
 
+// getEnvInt retrieves an integer environment variable within [min, max]
+func getEnvInt(key string, defaultValue, min, max int) (int, error) {
+	value, err := strconv.Atoi(getEnv(key, strconv.Itoa(defaultValue)))
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("invalid %s: must be between %d and %d", key, min, max)
+	}
+	return value, nil
+}
+
+// getEnvBool retrieves a boolean environment variable such as "true" or "0"
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	value, err := strconv.ParseBool(getEnv(key, strconv.FormatBool(defaultValue)))
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: must be true or false", key)
+	}
+	return value, nil
+}
+
+// getEnvDuration retrieves a non-negative duration environment variable such as "30s"
+func getEnvDuration(key, defaultValue string) (time.Duration, error) {
+	value, err := time.ParseDuration(getEnv(key, defaultValue))
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s: must be a positive duration such as 30s", key)
+	}
+	return value, nil
+}
+
+// getEnvList retrieves a comma separated environment variable as a list
+// Blank entries are dropped
+func getEnvList(key, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
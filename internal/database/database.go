@@ -1,81 +1,517 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"os"
+	"time"
 
 	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/store"
 
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
+// expiredBatchSize is how many expired links DeleteExpired handles per transaction
+const expiredBatchSize = 500
+
+// tombstone returns the updates that purge a deleted link, leaving its short
+// code taken so it is never handed out again, but not its destination
+func tombstone() map[string]any {
+	return map[string]any{"original_url": "", "normalized_url": "", "dedup_key": nil}
+}
+
+// schema lists every model the database holds a table for
+var schema = []any{
+	&models.User{}, &models.Session{}, &models.URL{}, &models.LinkRevision{}, &models.ArchivedURL{},
+	&models.Click{}, &models.APIKey{},
+}
+
+// Store is a store.Store backed by a GORM database
+type Store struct {
+	db *gorm.DB
+}
+
+var _ store.Store = (*Store)(nil)
+
+// Open prepares the database selected by driver and initializes it
+// For SQLite the directory at path is created when missing, and the
+// database file is kept in it unless dsn names another one
+func Open(driver, path, dsn string) (*Store, error) {
+	if driver != "sqlite" {
+		return Initialize(driver, dsn)
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// Directory doesn't exist, create it
+		err := os.MkdirAll(path, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+		log.Printf("Directory created: %s\n", path)
+	}
+
+	if dsn == "" {
+		dsn = path + "/urlshortener.db"
+	}
+	return Initialize(driver, dsn)
+}
 
 // Initialize sets up the database connection and performs migrations
+// The driver selects the SQL dialect ("sqlite" or "postgres") and dsn is
+// passed to it unchanged: a file path for SQLite, a connection string for PostgreSQL
 // It returns an error if the connection fails or migrations fail
-func Initialize(dbPath string) error {
-	var err error
+func Initialize(driver, dsn string) (*Store, error) {
+	dialector, err := newDialector(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
 
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	if err := DB.AutoMigrate(&models.URL{}); err != nil {
-		return fmt.Errorf("failed to migrate database: %w", err)
+	if err := migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	return nil
+	return &Store{db: db}, nil
 }
 
-// Close closes the database connection
-func Close() error {
-	if DB != nil {
-		sqlDB, err := DB.DB()
-		if err != nil {
+// migrate brings the schema up to date
+func migrate(db *gorm.DB) error {
+	// Databases created before custom aliases have a unique index on
+	// normalized_url and no dedup_key column
+	legacy := db.Migrator().HasTable(&models.URL{}) && !db.Migrator().HasColumn(&models.URL{}, "DedupKey")
+
+	if err := db.AutoMigrate(schema...); err != nil {
+		return err
+	}
+
+	if !legacy {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&models.URL{}, "idx_urls_normalized_url"); err != nil {
+			return err
+		}
+		if err := tx.Migrator().CreateIndex(&models.URL{}, "NormalizedURL"); err != nil {
 			return err
 		}
-		return sqlDB.Close()
+		// Every existing link was generated, so all of them stay shared
+		// Their keys stay in the normalized form of the time, URLs that now
+		// normalize differently get a new link
+		return tx.Model(&models.URL{}).Where("dedup_key IS NULL").
+			Update("dedup_key", gorm.Expr("normalized_url")).Error
+	})
+}
+
+// newDialector returns the GORM dialector for a driver name
+func newDialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case "sqlite":
+		return sqlite.Open(dsn), nil
+	case "postgres":
+		return postgres.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// Close closes the database connection
+func (s *Store) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Ping checks the database connection and that every table exists
+func (s *Store) Ping(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return err
+	}
+
+	migrator := s.db.WithContext(ctx).Migrator()
+	for _, model := range schema {
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("schema is not migrated: table for %T is missing", model)
+		}
 	}
 	return nil
 }
 
-// FindByShortCode retrieves a URL by its short code
-func FindByShortCode(shortCode string) (*models.URL, error) {
+// FindByShortCode retrieves a URL by its short code, deleted or not
+func (s *Store) FindByShortCode(shortCode string) (*models.URL, error) {
 	var url models.URL
-	result := DB.Where("short_code = ?", shortCode).First(&url)
+	result := s.db.Unscoped().Where("short_code = ?", shortCode).First(&url)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, translateError(result.Error)
 	}
 	return &url, nil
 }
 
-// FindByNormalizedURL retrieves a URL by its normalized form
+// FindByDedupKey retrieves the reusable URL with the given dedup key
 // This is used to check for duplicate URLs
-func FindByNormalizedURL(normalizedURL string) (*models.URL, error) {
+func (s *Store) FindByDedupKey(dedupKey string) (*models.URL, error) {
 	var url models.URL
-	result := DB.Where("normalized_url = ?", normalizedURL).First(&url)
+	result := s.db.Where("dedup_key = ?", dedupKey).First(&url)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, translateError(result.Error)
 	}
 	return &url, nil
 }
 
+// ListByOwner returns the links of a user, newest first
+func (s *Store) ListByOwner(ownerID uint) ([]models.URL, error) {
+	var urls []models.URL
+	if err := s.db.Where("owner_id = ?", ownerID).Order("id DESC").Find(&urls).Error; err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
 // Create saves a new URL mapping to the database
-func Create(url *models.URL) error {
-	result := DB.Create(url)
-	return result.Error
+func (s *Store) Create(url *models.URL) error {
+	result := s.db.Create(url)
+	return translateError(result.Error)
+}
+
+// AssignShortCode replaces the short code and dedup key of the URL with the given ID
+func (s *Store) AssignShortCode(id uint, shortCode string, dedupKey *string) error {
+	result := s.db.Model(&models.URL{}).Where("id = ?", id).
+		Updates(map[string]any{"short_code": shortCode, "dedup_key": dedupKey})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
 }
 
-// IsShortCodeTaken checks if a short code already exists
-func IsShortCodeTaken(shortCode string) (bool, error) {
+// UpdateDestination points a link at a new destination and saves the revision
+// The link only changes when it still points at the previous destination,
+// so concurrent edits can't silently overwrite each other
+func (s *Store) UpdateDestination(revision *models.LinkRevision, normalizedURL string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.URL{}).
+			Where("id = ? AND original_url = ?", revision.LinkID, revision.PreviousURL).
+			Updates(map[string]any{"original_url": revision.NewURL, "normalized_url": normalizedURL, "dedup_key": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return store.ErrConflict
+		}
+
+		var last int
+		err := tx.Model(&models.LinkRevision{}).Where("link_id = ?", revision.LinkID).
+			Select("COALESCE(MAX(number), 0)").Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		revision.Number = last + 1
+		return tx.Omit("Link", "Editor").Create(revision).Error
+	})
+	return translateError(err)
+}
+
+// ListRevisions returns the revisions of a link with their editors, newest first
+func (s *Store) ListRevisions(linkID uint) ([]models.LinkRevision, error) {
+	var revisions []models.LinkRevision
+	err := s.db.Preload("Editor").Where("link_id = ?", linkID).Order("number DESC").Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// DisableByShortCode disables the link with the given short code
+func (s *Store) DisableByShortCode(shortCode string, at time.Time, status int, reason string) error {
+	return s.updateByShortCode(shortCode, map[string]any{
+		"disabled_at": at, "disabled_status": status, "disabled_reason": reason, "dedup_key": nil,
+	})
+}
+
+// EnableByShortCode lets a disabled link redirect again
+func (s *Store) EnableByShortCode(shortCode string) error {
+	return s.updateByShortCode(shortCode, map[string]any{
+		"disabled_at": nil, "disabled_status": 0, "disabled_reason": "",
+	})
+}
+
+// DeleteByShortCode marks the URL mapping with the given short code deleted
+// The dedup key is cleared so that the URL can be shortened again, under another code
+func (s *Store) DeleteByShortCode(shortCode string) error {
+	err := s.updateByShortCode(shortCode, map[string]any{"deleted_at": time.Now(), "dedup_key": nil})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// updateByShortCode updates the link with the given short code unless it is deleted
+func (s *Store) updateByShortCode(shortCode string, values map[string]any) error {
+	result := s.db.Model(&models.URL{}).Where("short_code = ?", shortCode).Updates(values)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// PurgeDeleted turns the links deleted at or before the given time into tombstones
+// Revisions are removed explicitly, SQLite doesn't enforce foreign keys by default
+func (s *Store) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		deleted := tx.Unscoped().Model(&models.URL{}).Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at <= ? AND original_url <> ''", before)
+		if err := tx.Where("link_id IN (?)", deleted).Delete(&models.LinkRevision{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Model(&models.URL{}).
+			Where("deleted_at IS NOT NULL AND deleted_at <= ? AND original_url <> ''", before).
+			Updates(tombstone())
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// IsShortCodeTaken checks if a short code already exists, deleted links included
+func (s *Store) IsShortCodeTaken(shortCode string) (bool, error) {
 	var count int64
-	result := DB.Model(&models.URL{}).Where("short_code = ?", shortCode).Count(&count)
+	result := s.db.Unscoped().Model(&models.URL{}).Where("short_code = ?", shortCode).Count(&count)
 	if result.Error != nil {
 		return false, result.Error
 	}
 	return count > 0, nil
 }
+
+// DeleteExpired deletes every link that has expired at the given time and
+// turns it into a tombstone, whether it was deleted already or not
+// Links are processed in batches so a large backlog doesn't hold one long transaction
+func (s *Store) DeleteExpired(now time.Time, archive bool) (int64, error) {
+	var removed int64
+	for {
+		var expired []models.URL
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Unscoped().Where("expires_at IS NOT NULL AND expires_at <= ? AND original_url <> ''", now).
+				Limit(expiredBatchSize).Find(&expired)
+			if result.Error != nil || len(expired) == 0 {
+				return result.Error
+			}
+
+			if archive {
+				archived := make([]models.ArchivedURL, 0, len(expired))
+				for i := range expired {
+					archived = append(archived, expired[i].Archive(now))
+				}
+				if err := tx.Create(&archived).Error; err != nil {
+					return err
+				}
+			}
+
+			ids := make([]uint, 0, len(expired))
+			for i := range expired {
+				ids = append(ids, expired[i].ID)
+			}
+			if err := tx.Where("link_id IN ?", ids).Delete(&models.LinkRevision{}).Error; err != nil {
+				return err
+			}
+
+			values := tombstone()
+			values["deleted_at"] = gorm.Expr("COALESCE(deleted_at, ?)", now)
+			return tx.Unscoped().Model(&models.URL{}).Where("id IN ?", ids).Updates(values).Error
+		})
+		if err != nil {
+			return removed, err
+		}
+
+		removed += int64(len(expired))
+		if len(expired) < expiredBatchSize {
+			return removed, nil
+		}
+	}
+}
+
+// RecordClicks saves a batch of click events in a single insert
+func (s *Store) RecordClicks(clicks []models.Click) error {
+	return s.db.Create(&clicks).Error
+}
+
+// ClickStats aggregates the clicks of a short link
+func (s *Store) ClickStats(shortCode string, since time.Time, limit int) (*models.ClickStats, error) {
+	stats := &models.ClickStats{
+		ShortCode:     shortCode,
+		ClicksPerDay:  []models.DayCount{},
+		TopReferrers:  []models.ValueCount{},
+		TopUserAgents: []models.ValueCount{},
+	}
+	clicks := s.db.Model(&models.Click{}).Where("short_code = ?", shortCode)
+
+	if err := clicks.Session(&gorm.Session{}).Count(&stats.TotalClicks).Error; err != nil {
+		return nil, err
+	}
+
+	err := clicks.Session(&gorm.Session{}).
+		Select("day, COUNT(*) AS clicks").
+		Where("day >= ?", since.UTC().Format(time.DateOnly)).
+		Group("day").Order("day").
+		Scan(&stats.ClicksPerDay).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = clicks.Session(&gorm.Session{}).
+		Select("referrer AS value, COUNT(*) AS clicks").
+		Group("referrer").Order("clicks DESC, value").Limit(limit).
+		Scan(&stats.TopReferrers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = clicks.Session(&gorm.Session{}).
+		Select("ua_family AS value, COUNT(*) AS clicks").
+		Group("ua_family").Order("clicks DESC, value").Limit(limit).
+		Scan(&stats.TopUserAgents).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// CreateAPIKey saves a new API key and fills in its ID
+func (s *Store) CreateAPIKey(key *models.APIKey) error {
+	return translateError(s.db.Create(key).Error)
+}
+
+// FindAPIKeyByHash retrieves the API key with the given hash
+func (s *Store) FindAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	result := s.db.Where("key_hash = ?", keyHash).First(&key)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return &key, nil
+}
+
+// ListAPIKeys returns every API key, oldest first
+func (s *Store) ListAPIKeys() ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the API key with the given prefix
+func (s *Store) RevokeAPIKey(prefix string, at time.Time) error {
+	key, err := s.findAPIKeyByPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	if key.IsRevoked() {
+		return nil
+	}
+	return s.db.Model(key).Update("revoked_at", at).Error
+}
+
+// TouchAPIKey records that the API key with the given ID was used
+func (s *Store) TouchAPIKey(id uint, at time.Time) error {
+	return s.db.Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+// findAPIKeyByPrefix retrieves the API key with the given prefix
+func (s *Store) findAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	result := s.db.Where("prefix = ?", prefix).First(&key)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return &key, nil
+}
+
+// CreateUser saves a new user and fills in its ID
+func (s *Store) CreateUser(user *models.User) error {
+	return translateError(s.db.Create(user).Error)
+}
+
+// FindUserByEmail retrieves the user registered with an email
+func (s *Store) FindUserByEmail(email string) (*models.User, error) {
+	var user models.User
+	result := s.db.Where("email = ?", email).First(&user)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return &user, nil
+}
+
+// FindUserByID retrieves a user by its ID
+func (s *Store) FindUserByID(id uint) (*models.User, error) {
+	var user models.User
+	result := s.db.First(&user, id)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return &user, nil
+}
+
+// CreateSession saves a new session and fills in its ID
+func (s *Store) CreateSession(session *models.Session) error {
+	return translateError(s.db.Omit("User").Create(session).Error)
+}
+
+// FindSessionByHash retrieves the session with the given token hash
+func (s *Store) FindSessionByHash(tokenHash string) (*models.Session, error) {
+	var session models.Session
+	result := s.db.Preload("User").Where("token_hash = ?", tokenHash).First(&session)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return &session, nil
+}
+
+// DeleteSession removes the session with the given token hash
+func (s *Store) DeleteSession(tokenHash string) error {
+	return s.db.Where("token_hash = ?", tokenHash).Delete(&models.Session{}).Error
+}
+
+// DeleteExpiredSessions removes every session that has expired at the given time
+func (s *Store) DeleteExpiredSessions(now time.Time) (int64, error) {
+	result := s.db.Where("expires_at <= ?", now).Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
+
+// translateError maps GORM errors onto the store package errors
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return store.ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return store.ErrConflict
+	default:
+		return err
+	}
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// postgresDSNEnv names the variable holding the DSN of a scratch PostgreSQL
+// database, the tests below drop every table in it
+const postgresDSNEnv = "TEST_POSTGRES_DSN"
+
+// legacyURL is the links table as it was before custom aliases
+type legacyURL struct {
+	ID            uint   `gorm:"primaryKey"`
+	ShortCode     string `gorm:"uniqueIndex;not null;size:20"`
+	OriginalURL   string `gorm:"not null;size:2048"`
+	NormalizedURL string `gorm:"uniqueIndex;not null;size:2048"`
+}
+
+func (legacyURL) TableName() string {
+	return "urls"
+}
+
+// emptyPostgres returns the DSN of the scratch database with every table dropped,
+// skipping the test when no database is configured
+func emptyPostgres(t *testing.T) string {
+	t.Helper()
+
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+
+	dialector, err := newDialector("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	if err := db.Migrator().DropTable(schema...); err != nil {
+		t.Fatalf("failed to drop tables: %v", err)
+	}
+	closeDB(t, db)
+	return dsn
+}
+
+// openPostgres opens the store on the scratch database
+func openPostgres(t *testing.T, dsn string) *Store {
+	t.Helper()
+
+	s, err := Open("postgres", "", dsn)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func closeDB(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+}
+
+func TestPostgresLinks(t *testing.T) {
+	s := openPostgres(t, emptyPostgres(t))
+
+	if err := s.Ping(t.Context()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	dedupKey := "https://example.com"
+	link := &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com/", NormalizedURL: dedupKey, DedupKey: &dedupKey}
+	if err := s.Create(link); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	found, err := s.FindByShortCode("abc123")
+	if err != nil || found.ID != link.ID {
+		t.Fatalf("FindByShortCode = %v, %v, want link %d", found, err, link.ID)
+	}
+	if _, err := s.FindByShortCode("missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("FindByShortCode(missing) error = %v, want ErrNotFound", err)
+	}
+
+	duplicate := &models.URL{ShortCode: "abc123", OriginalURL: "https://example.org", NormalizedURL: "https://example.org"}
+	if err := s.Create(duplicate); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("Create with a taken short code error = %v, want ErrConflict", err)
+	}
+
+	if err := s.DeleteByShortCode("abc123"); err != nil {
+		t.Fatalf("DeleteByShortCode: %v", err)
+	}
+	if _, err := s.FindByDedupKey(dedupKey); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("FindByDedupKey after delete error = %v, want ErrNotFound", err)
+	}
+	if taken, err := s.IsShortCodeTaken("abc123"); err != nil || !taken {
+		t.Errorf("IsShortCodeTaken after delete = %v, %v, want true", taken, err)
+	}
+
+	purged, err := s.PurgeDeleted(time.Now())
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeDeleted = %d, %v, want 1", purged, err)
+	}
+	if taken, err := s.IsShortCodeTaken("abc123"); err != nil || !taken {
+		t.Errorf("IsShortCodeTaken after purge = %v, %v, want the tombstone to keep it taken", taken, err)
+	}
+	if purged, err := s.PurgeDeleted(time.Now()); err != nil || purged != 0 {
+		t.Errorf("second PurgeDeleted = %d, %v, want 0", purged, err)
+	}
+}
+
+func TestPostgresMigratesLegacyLinks(t *testing.T) {
+	dsn := emptyPostgres(t)
+
+	dialector, err := newDialector("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	if err := db.AutoMigrate(&legacyURL{}); err != nil {
+		t.Fatalf("failed to create legacy table: %v", err)
+	}
+	legacy := []legacyURL{
+		{ShortCode: "old001", OriginalURL: "https://example.com/a", NormalizedURL: "https://example.com/a"},
+		{ShortCode: "old002", OriginalURL: "https://example.com/b", NormalizedURL: "https://example.com/b"},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatalf("failed to insert legacy links: %v", err)
+	}
+	closeDB(t, db)
+
+	s := openPostgres(t, dsn)
+
+	for _, link := range legacy {
+		found, err := s.FindByDedupKey(link.NormalizedURL)
+		if err != nil || found.ShortCode != link.ShortCode {
+			t.Errorf("FindByDedupKey(%q) = %v, %v, want %s", link.NormalizedURL, found, err, link.ShortCode)
+		}
+	}
+
+	// The unique index on normalized_url is gone, aliases may share a URL
+	alias := &models.URL{ShortCode: "alias", OriginalURL: "https://example.com/a", NormalizedURL: "https://example.com/a"}
+	if err := s.Create(alias); err != nil {
+		t.Errorf("Create alias for a legacy URL: %v", err)
+	}
+}
+
+func TestPostgresDeleteExpired(t *testing.T) {
+	s := openPostgres(t, emptyPostgres(t))
+
+	now := time.Now()
+	expiredAt := now.Add(-time.Hour)
+	expiresAt := now.Add(time.Hour)
+
+	// More than one batch, so the loop in DeleteExpired runs twice
+	expired := make([]models.URL, expiredBatchSize+10)
+	for i := range expired {
+		code := fmt.Sprintf("exp%d", i)
+		expired[i] = models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code, NormalizedURL: "https://example.com/" + code, ExpiresAt: &expiredAt}
+	}
+	if err := s.db.CreateInBatches(&expired, 100).Error; err != nil {
+		t.Fatalf("failed to create expired links: %v", err)
+	}
+	revision := &models.LinkRevision{LinkID: expired[0].ID, PreviousURL: expired[0].OriginalURL, NewURL: "https://example.org"}
+	if err := s.UpdateDestination(revision, "https://example.org"); err != nil {
+		t.Fatalf("UpdateDestination: %v", err)
+	}
+
+	live := &models.URL{ShortCode: "live", OriginalURL: "https://example.com/live", NormalizedURL: "https://example.com/live", ExpiresAt: &expiresAt}
+	if err := s.Create(live); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	removed, err := s.DeleteExpired(now, true)
+	if err != nil {
+		t.Fatalf("DeleteExpired: %v", err)
+	}
+	if removed != int64(len(expired)) {
+		t.Errorf("DeleteExpired removed %d links, want %d", removed, len(expired))
+	}
+
+	var archived, revisions int64
+	s.db.Model(&models.ArchivedURL{}).Count(&archived)
+	s.db.Model(&models.LinkRevision{}).Count(&revisions)
+	if archived != int64(len(expired)) {
+		t.Errorf("archived %d links, want %d", archived, len(expired))
+	}
+	if revisions != 0 {
+		t.Errorf("%d revisions left, want 0", revisions)
+	}
+
+	if _, err := s.FindByShortCode("live"); err != nil {
+		t.Errorf("FindByShortCode(live) after DeleteExpired: %v", err)
+	}
+	if tomb, err := s.FindByShortCode("exp0"); err != nil || !tomb.IsPurged() {
+		t.Errorf("FindByShortCode(exp0) = %+v, %v, want its tombstone", tomb, err)
+	}
+	if removed, err := s.DeleteExpired(now, true); err != nil || removed != 0 {
+		t.Errorf("second DeleteExpired = %d, %v, want 0", removed, err)
+	}
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/accounts"
+	"github.com/ItsDobiel/URLShortener/internal/apikey"
+	"github.com/ItsDobiel/URLShortener/internal/logging"
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/shortener"
+)
+
+// sessionCookie holds the session token of a logged in user
+// It is SameSite=Lax, so other sites can't make a logged in browser post forms
+const sessionCookie = "session"
+
+// RegisterHandler shows the registration form and creates accounts
+func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.renderPage(w, r, "register.html", http.StatusOK, nil)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, password := r.PostFormValue("email"), r.PostFormValue("password")
+	user, err := h.accounts.Register(email, password)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, accounts.ErrEmailTaken):
+			status = http.StatusConflict
+		case !errors.Is(err, accounts.ErrInvalidEmail) && !errors.Is(err, accounts.ErrWeakPassword):
+			h.renderError(w, "Failed to create account", http.StatusInternalServerError)
+			return
+		}
+		h.renderPage(w, r, "register.html", status, map[string]any{"Error": err.Error(), "Email": email})
+		return
+	}
+
+	token, expiresAt, err := h.accounts.StartSession(user)
+	if err != nil {
+		h.renderError(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	h.setSessionCookie(w, token, expiresAt)
+	http.Redirect(w, r, "/links", http.StatusSeeOther)
+}
+
+// LoginHandler shows the login form and logs users in
+func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.renderPage(w, r, "login.html", http.StatusOK, nil)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email := r.PostFormValue("email")
+	token, expiresAt, err := h.accounts.Login(email, r.PostFormValue("password"))
+	if errors.Is(err, accounts.ErrInvalidCredentials) {
+		h.renderPage(w, r, "login.html", http.StatusUnauthorized, map[string]any{"Error": err.Error(), "Email": email})
+		return
+	}
+	if err != nil {
+		h.renderError(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	h.setSessionCookie(w, token, expiresAt)
+	http.Redirect(w, r, "/links", http.StatusSeeOther)
+}
+
+// LogoutHandler ends the session of the current user
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if err := h.accounts.Logout(cookie.Value); err != nil {
+			h.renderError(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.setSessionCookie(w, "", time.Unix(0, 0))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// MyLinksHandler lists the links of the logged in user
+func (h *Handler) MyLinksHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.currentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	urls, err := h.shortener.ListLinks(user.ID)
+	if err != nil {
+		h.renderError(w, "Failed to list your links", http.StatusInternalServerError)
+		return
+	}
+
+	links := make([]map[string]any, 0, len(urls))
+	for i := range urls {
+		links = append(links, h.linkView(&urls[i]))
+	}
+	h.renderPage(w, r, "links.html", http.StatusOK, map[string]any{"Links": links})
+}
+
+// MyLinkHandler shows one of the logged in user's links with its history
+func (h *Handler) MyLinkHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.currentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	shortCode := r.PathValue("code")
+	logging.SetShortCode(r, shortCode)
+	h.renderLink(w, r, user, shortCode, http.StatusOK, nil)
+}
+
+// EditMyLinkHandler points one of the logged in user's links at a new URL
+func (h *Handler) EditMyLinkHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.currentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	shortCode := r.PathValue("code")
+	logging.SetShortCode(r, shortCode)
+
+	rawURL := strings.TrimSpace(r.PostFormValue("url"))
+	if _, err := h.shortener.UpdateDestination(shortCode, rawURL, shortener.Caller{UserID: user.ID}); err != nil {
+		h.renderLinkError(w, r, user, shortCode, rawURL, err)
+		return
+	}
+	http.Redirect(w, r, "/links/"+shortCode, http.StatusSeeOther)
+}
+
+// RestoreMyLinkHandler points one of the logged in user's links back at a
+// destination from its history
+func (h *Handler) RestoreMyLinkHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.currentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	shortCode := r.PathValue("code")
+	logging.SetShortCode(r, shortCode)
+
+	number, err := strconv.Atoi(r.PathValue("revision"))
+	if err != nil || number < 0 {
+		h.renderError(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := h.shortener.RestoreRevision(shortCode, number, shortener.Caller{UserID: user.ID}); err != nil {
+		h.renderLinkError(w, r, user, shortCode, "", err)
+		return
+	}
+	http.Redirect(w, r, "/links/"+shortCode, http.StatusSeeOther)
+}
+
+// DisableMyLinkHandler stops one of the logged in user's links from redirecting
+func (h *Handler) DisableMyLinkHandler(w http.ResponseWriter, r *http.Request) {
+	h.manageMyLink(w, r, func(shortCode string, caller shortener.Caller) error {
+		_, err := h.shortener.DisableLink(shortCode, 0, r.PostFormValue("reason"), caller)
+		return err
+	})
+}
+
+// EnableMyLinkHandler lets one of the logged in user's disabled links redirect again
+func (h *Handler) EnableMyLinkHandler(w http.ResponseWriter, r *http.Request) {
+	h.manageMyLink(w, r, func(shortCode string, caller shortener.Caller) error {
+		_, err := h.shortener.EnableLink(shortCode, caller)
+		return err
+	})
+}
+
+// DeleteMyLinkHandler deletes one of the logged in user's links
+func (h *Handler) DeleteMyLinkHandler(w http.ResponseWriter, r *http.Request) {
+	h.manageMyLink(w, r, h.shortener.DeleteURL)
+}
+
+// manageMyLink applies an action to the logged in user's link in the path,
+// then goes back to their links
+func (h *Handler) manageMyLink(w http.ResponseWriter, r *http.Request, action func(shortCode string, caller shortener.Caller) error) {
+	user := h.currentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	shortCode := r.PathValue("code")
+	logging.SetShortCode(r, shortCode)
+
+	if err := action(shortCode, shortener.Caller{UserID: user.ID}); err != nil {
+		h.renderError(w, err.Error(), statusForError(err))
+		return
+	}
+	http.Redirect(w, r, "/links", http.StatusSeeOther)
+}
+
+// renderLink renders the page of one of user's links, with data added to it
+func (h *Handler) renderLink(w http.ResponseWriter, r *http.Request, user *models.User, shortCode string, statusCode int, data map[string]any) {
+	urlModel, revisions, err := h.shortener.ListRevisions(shortCode, shortener.Caller{UserID: user.ID})
+	if err != nil {
+		h.renderError(w, err.Error(), statusForError(err))
+		return
+	}
+	if !urlModel.IsOwnedBy(user.ID) {
+		h.renderError(w, "You can only manage your own links", http.StatusForbidden)
+		return
+	}
+
+	// Revision 0 stands for the destination the link was created with, and
+	// destinations equal to the current one can't be restored
+	history := make([]map[string]any, 0, len(revisions)+1)
+	for i, revision := range revisions {
+		entry := map[string]any{
+			"Latest":      i == 0,
+			"Number":      revision.Number,
+			"Destination": revision.NewURL,
+			"PreviousURL": revision.PreviousURL,
+			"Restored":    revision.RestoredFrom != nil,
+			"Editor":      "",
+			"CreatedAt":   revision.CreatedAt,
+			"Current":     revision.NewURL == urlModel.OriginalURL,
+		}
+		if revision.RestoredFrom != nil {
+			entry["RestoredFrom"] = *revision.RestoredFrom
+		}
+		if revision.Editor != nil {
+			entry["Editor"] = revision.Editor.Email
+		}
+		history = append(history, entry)
+	}
+	if len(revisions) > 0 {
+		original := revisions[len(revisions)-1].PreviousURL
+		history = append(history, map[string]any{
+			"Latest":      false,
+			"Number":      0,
+			"Destination": original,
+			"CreatedAt":   urlModel.CreatedAt,
+			"Current":     original == urlModel.OriginalURL,
+		})
+	}
+
+	if data == nil {
+		data = make(map[string]any)
+	}
+	data["User"] = user
+	data["Link"] = h.linkView(urlModel)
+	data["History"] = history
+	if _, ok := data["URL"]; !ok {
+		data["URL"] = urlModel.OriginalURL
+	}
+	h.renderPage(w, r, "link.html", statusCode, data)
+}
+
+// renderLinkError shows why a link couldn't be changed, on the link's page
+// when the user can fix it and on the error page otherwise
+func (h *Handler) renderLinkError(w http.ResponseWriter, r *http.Request, user *models.User, shortCode, rawURL string, err error) {
+	status := statusForError(err)
+	switch status {
+	case http.StatusBadRequest, http.StatusConflict:
+		data := map[string]any{"Error": err.Error()}
+		if rawURL != "" {
+			data["URL"] = rawURL
+		}
+		h.renderLink(w, r, user, shortCode, status, data)
+	case http.StatusInternalServerError:
+		h.renderError(w, "Failed to update link", status)
+	default:
+		h.renderError(w, err.Error(), status)
+	}
+}
+
+// linkView holds what the pages of the logged in user show about a link
+func (h *Handler) linkView(url *models.URL) map[string]any {
+	return map[string]any{
+		"ShortCode":   url.ShortCode,
+		"ShortURL":    h.config.GetShortURL(url.ShortCode),
+		"OriginalURL": url.OriginalURL,
+		"CreatedAt":   url.CreatedAt,
+		"ExpiresAt":   url.ExpiresAt,
+		"Expired":     url.IsExpired(time.Now()),
+		"Disabled":    url.IsDisabled(),
+	}
+}
+
+// currentUser returns the user logged in with the request's session cookie, if any
+func (h *Handler) currentUser(r *http.Request) *models.User {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+
+	user, err := h.accounts.Authenticate(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// userID returns the user a request acts for: the owner of its API key when
+// it authenticated with one, the logged in user otherwise, 0 for anonymous requests
+func (h *Handler) userID(r *http.Request) uint {
+	if key := apikey.FromContext(r.Context()); key != nil {
+		if key.UserID == nil {
+			return 0
+		}
+		return *key.UserID
+	}
+	if isAPIRequest(r) {
+		return 0
+	}
+
+	if user := h.currentUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// caller returns who a request acts for, see userID
+// Requests authenticated with a key of the admin scope may manage every link
+func (h *Handler) caller(r *http.Request) shortener.Caller {
+	key := apikey.FromContext(r.Context())
+	return shortener.Caller{UserID: h.userID(r), Admin: key != nil && key.HasScope(apikey.ScopeAdmin)}
+}
+
+// setSessionCookie hands the session token to the browser, an expiry in
+// the past removes it
+func (h *Handler) setSessionCookie(w http.ResponseWriter, token string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   h.config.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// renderPage renders a template with data, adding the logged in user for the navigation
+func (h *Handler) renderPage(w http.ResponseWriter, r *http.Request, name string, statusCode int, data map[string]any) {
+	if data == nil {
+		data = make(map[string]any)
+	}
+	if _, ok := data["User"]; !ok {
+		data["User"] = h.currentUser(r)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	if err := h.templates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+	}
+}
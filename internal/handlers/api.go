@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/logging"
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/shortener"
+)
+
+const (
+	// maxAPIBodySize limits how much of a request body the API will read
+	maxAPIBodySize = 64 << 10
+
+	// defaultStatsDays and maxStatsDays bound the clicks per day in link stats
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+
+	// statsTopLimit is the length of the top referrer and user agent lists
+	statsTopLimit = 10
+
+	// codeBadRequest, codeRateLimited, codeUnauthorized, codeForbidden and
+	// codeInternal complement the service error codes
+	codeBadRequest   = "bad_request"
+	codeRateLimited  = "rate_limited"
+	codeUnauthorized = "unauthorized"
+	codeForbidden    = "forbidden"
+	codeInternal     = "internal_error"
+)
+
+// createLinkRequest is the JSON body accepted by APICreateLinkHandler
+type createLinkRequest struct {
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+	// ExpiresAt is an RFC 3339 timestamp, TTL a Go duration such as "24h"
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       string     `json:"ttl,omitempty"`
+	// RedirectStatus is 301, 302, 307 or 308, omitted for the server default
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// KeepTrackingParams leaves utm_* and similar parameters in the URL
+	KeepTrackingParams bool `json:"keep_tracking_params,omitempty"`
+}
+
+// disableLinkRequest is the optional JSON body accepted by APIDisableLinkHandler
+type disableLinkRequest struct {
+	// Status is 410 or 451, omitted for the server default
+	Status int    `json:"status,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// updateLinkRequest is the JSON body accepted by APIUpdateLinkHandler
+type updateLinkRequest struct {
+	URL string `json:"url"`
+}
+
+// linkResponse is the JSON representation of a short link
+type linkResponse struct {
+	ShortCode   string     `json:"short_code"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   time.Time  `json:"created_at,omitzero"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// RedirectStatus is the status code the link redirects with
+	RedirectStatus int `json:"redirect_status"`
+	// DisabledAt is set while the link is disabled, its redirect answering
+	// DisabledStatus with DisabledReason instead
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledStatus int        `json:"disabled_status,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+}
+
+// revisionResponse is the JSON representation of a change of destination
+type revisionResponse struct {
+	Number      int    `json:"number"`
+	PreviousURL string `json:"previous_url"`
+	NewURL      string `json:"new_url"`
+	// RestoredFrom is the revision that was restored, 0 for the original destination
+	RestoredFrom *int `json:"restored_from,omitempty"`
+	// Editor is the email of the user who made the change
+	Editor    string    `json:"editor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// revisionsResponse is the history of a link, newest first
+type revisionsResponse struct {
+	ShortCode string             `json:"short_code"`
+	Revisions []revisionResponse `json:"revisions"`
+}
+
+// errorResponse is the JSON body returned for every API error
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// APICreateLinkHandler shortens a URL sent as JSON
+// It answers 201 for new links and 200 when an existing link is reused
+func (h *Handler) APICreateLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if h.rateLimited(w, r, h.shortenLimiter, "shorten") {
+		writeAPIError(w, http.StatusTooManyRequests, codeRateLimited, "too many links created, please try again later")
+		return
+	}
+
+	var req createLinkRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	if req.URL == "" {
+		writeAPIError(w, http.StatusBadRequest, shortener.CodeInvalidURL, "URL is required")
+		return
+	}
+
+	ttl, err := parseTTL(req.TTL)
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	urlModel, created, err := h.shortener.ShortenURL(req.URL, shortener.ShortenOptions{
+		Alias:              strings.TrimSpace(req.Alias),
+		ExpiresAt:          req.ExpiresAt,
+		TTL:                ttl,
+		RedirectStatus:     req.RedirectStatus,
+		KeepTrackingParams: req.KeepTrackingParams,
+		OwnerID:            h.userID(r),
+	})
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	logging.SetShortCode(r, urlModel.ShortCode)
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, h.newLinkResponse(urlModel))
+}
+
+// APIGetLinkHandler returns the link stored under the short code in the path
+func (h *Handler) APIGetLinkHandler(w http.ResponseWriter, r *http.Request) {
+	logging.SetShortCode(r, r.PathValue("code"))
+
+	urlModel, err := h.shortener.GetURL(r.PathValue("code"))
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.newLinkResponse(urlModel))
+}
+
+// APIUpdateLinkHandler points the link in the path at the URL sent as JSON
+func (h *Handler) APIUpdateLinkHandler(w http.ResponseWriter, r *http.Request) {
+	logging.SetShortCode(r, r.PathValue("code"))
+
+	var req updateLinkRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	if req.URL == "" {
+		writeAPIError(w, http.StatusBadRequest, shortener.CodeInvalidURL, "URL is required")
+		return
+	}
+
+	urlModel, err := h.shortener.UpdateDestination(r.PathValue("code"), req.URL, h.caller(r))
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.newLinkResponse(urlModel))
+}
+
+// APIListRevisionsHandler returns the history of the link in the path
+func (h *Handler) APIListRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	logging.SetShortCode(r, r.PathValue("code"))
+
+	urlModel, revisions, err := h.shortener.ListRevisions(r.PathValue("code"), h.caller(r))
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	resp := revisionsResponse{ShortCode: urlModel.ShortCode, Revisions: make([]revisionResponse, 0, len(revisions))}
+	for _, revision := range revisions {
+		item := revisionResponse{
+			Number:       revision.Number,
+			PreviousURL:  revision.PreviousURL,
+			NewURL:       revision.NewURL,
+			RestoredFrom: revision.RestoredFrom,
+			CreatedAt:    revision.CreatedAt,
+		}
+		if revision.Editor != nil {
+			item.Editor = revision.Editor.Email
+		}
+		resp.Revisions = append(resp.Revisions, item)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// APIRestoreRevisionHandler points the link in the path back at the
+// destination it had after a revision, 0 for its original destination
+func (h *Handler) APIRestoreRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	logging.SetShortCode(r, r.PathValue("code"))
+
+	number, err := strconv.Atoi(r.PathValue("revision"))
+	if err != nil || number < 0 {
+		writeAPIError(w, http.StatusBadRequest, codeBadRequest, "revision must be a number, 0 for the original destination")
+		return
+	}
+
+	urlModel, err := h.shortener.RestoreRevision(r.PathValue("code"), number, h.caller(r))
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.newLinkResponse(urlModel))
+}
+
+// APIDisableLinkHandler stops the link in the path from redirecting
+// The body may set the status, 410 or 451, and the reason shown instead
+func (h *Handler) APIDisableLinkHandler(w http.ResponseWriter, r *http.Request) {
+	logging.SetShortCode(r, r.PathValue("code"))
+
+	// The body is optional, whether it is sent with a length or chunked
+	var req disableLinkRequest
+	if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, errEmptyBody) {
+		writeAPIError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	urlModel, err := h.shortener.DisableLink(r.PathValue("code"), req.Status, req.Reason, h.caller(r))
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.newLinkResponse(urlModel))
+}
+
+// APIEnableLinkHandler lets the disabled link in the path redirect again
+func (h *Handler) APIEnableLinkHandler(w http.ResponseWriter, r *http.Request) {
+	logging.SetShortCode(r, r.PathValue("code"))
+
+	urlModel, err := h.shortener.EnableLink(r.PathValue("code"), h.caller(r))
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.newLinkResponse(urlModel))
+}
+
+// APIDeleteLinkHandler deletes the link stored under the short code in the path
+func (h *Handler) APIDeleteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	logging.SetShortCode(r, r.PathValue("code"))
+
+	if err := h.shortener.DeleteURL(r.PathValue("code"), h.caller(r)); err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APILinkStatsHandler returns the click statistics of the link in the path
+// The optional days query parameter sets how many days of clicks per day to include
+func (h *Handler) APILinkStatsHandler(w http.ResponseWriter, r *http.Request) {
+	shortCode := r.PathValue("code")
+	logging.SetShortCode(r, shortCode)
+
+	if _, err := h.shortener.GetLinkForStats(shortCode, h.caller(r)); err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	days := defaultStatsDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxStatsDays {
+			writeAPIError(w, http.StatusBadRequest, codeBadRequest,
+				fmt.Sprintf("days must be a number between 1 and %d", maxStatsDays))
+			return
+		}
+		days = parsed
+	}
+
+	stats, err := h.analytics.Stats(shortCode, days, statsTopLimit)
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// APINotFoundHandler answers unknown API routes with a JSON error
+func (h *Handler) APINotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, shortener.CodeNotFound, "no such API endpoint")
+}
+
+// newLinkResponse converts a URL model into its API representation
+func (h *Handler) newLinkResponse(urlModel *models.URL) linkResponse {
+	resp := linkResponse{
+		ShortCode:      urlModel.ShortCode,
+		ShortURL:       h.config.GetShortURL(urlModel.ShortCode),
+		OriginalURL:    urlModel.OriginalURL,
+		CreatedAt:      urlModel.CreatedAt,
+		ExpiresAt:      urlModel.ExpiresAt,
+		RedirectStatus: h.config.RedirectStatus(urlModel.RedirectStatus),
+	}
+	if urlModel.IsDisabled() {
+		resp.DisabledAt = urlModel.DisabledAt
+		resp.DisabledStatus = h.config.DisabledStatus(urlModel.DisabledStatus)
+		resp.DisabledReason = urlModel.DisabledReason
+	}
+	return resp
+}
+
+// writeServiceError maps a shortener error to an API error response
+func (h *Handler) writeServiceError(w http.ResponseWriter, err error) {
+	code := shortener.ErrorCode(err)
+	if code == "" {
+		writeAPIError(w, http.StatusInternalServerError, codeInternal, "internal server error")
+		return
+	}
+
+	writeAPIError(w, statusForError(err), code, err.Error())
+}
+
+// statusForError picks the HTTP status matching a shortener error
+func statusForError(err error) int {
+	switch shortener.ErrorCode(err) {
+	case shortener.CodeInvalidURL, shortener.CodeBlockedDestination, shortener.CodeSelfLink,
+		shortener.CodeInvalidShortCode, shortener.CodeInvalidAlias,
+		shortener.CodeInvalidExpiry, shortener.CodeInvalidRedirect, shortener.CodeInvalidDisable:
+		return http.StatusBadRequest
+	case shortener.CodeForbidden:
+		return http.StatusForbidden
+	case shortener.CodeNotFound:
+		return http.StatusNotFound
+	case shortener.CodeAliasTaken, shortener.CodeAliasReserved, shortener.CodeEditConflict:
+		return http.StatusConflict
+	case shortener.CodeExpired:
+		return http.StatusGone
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseTTL parses an optional TTL given as a Go duration string
+func parseTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, &shortener.Error{
+			Code:    shortener.CodeInvalidExpiry,
+			Message: "TTL must be a duration such as 90m or 24h",
+		}
+	}
+	return ttl, nil
+}
+
+// parseRedirectStatus parses an optional redirect status code from a form
+func parseRedirectStatus(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &shortener.Error{
+			Code:    shortener.CodeInvalidRedirect,
+			Message: "redirect status must be 301, 302, 307 or 308",
+		}
+	}
+	return status, nil
+}
+
+// errEmptyBody is returned by decodeJSON for requests without a body
+var errEmptyBody = errors.New("request body is empty")
+
+// decodeJSON reads a single JSON object from the request body into dst
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	if err := decoder.Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return errors.New("request body is too large")
+		case errors.Is(err, io.EOF):
+			return errEmptyBody
+		default:
+			return errors.New("request body must be a valid JSON object")
+		}
+	}
+	return nil
+}
+
+// writeJSON encodes v as the JSON response body
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes a JSON error response
+func writeAPIError(w http.ResponseWriter, statusCode int, code, message string) {
+	writeJSON(w, statusCode, errorResponse{
+		Error: errorDetail{Code: code, Message: message},
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ItsDobiel/URLShortener/internal/apikey"
+	"github.com/ItsDobiel/URLShortener/internal/logging"
+	"github.com/ItsDobiel/URLShortener/internal/metrics"
+)
+
+// Authenticate checks the API key of a request before passing it to next
+// Requests without a key go through anonymously when scope is one of the
+// anonymous scopes, unless keys are required for the API. A key that is
+// unknown, revoked or lacks scope is rejected
+func (h *Handler) Authenticate(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := apiKey(r)
+		if key == "" {
+			if isAPIRequest(r) && (h.config.RequireAPIKeys || !slices.Contains(apikey.AnonymousScopes, scope)) {
+				metrics.AuthFailures.WithLabelValues(metrics.AuthMissing).Inc()
+				h.writeAuthError(w, r, http.StatusUnauthorized, codeUnauthorized, "an API key is required")
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		authenticated, err := h.auth.Authenticate(key)
+		switch {
+		case errors.Is(err, apikey.ErrInvalidKey):
+			metrics.AuthFailures.WithLabelValues(metrics.AuthInvalid).Inc()
+			h.writeAuthError(w, r, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		case errors.Is(err, apikey.ErrRevokedKey):
+			metrics.AuthFailures.WithLabelValues(metrics.AuthRevoked).Inc()
+			h.writeAuthError(w, r, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		case err != nil:
+			h.writeAuthError(w, r, http.StatusInternalServerError, codeInternal, "failed to check API key")
+			return
+		}
+
+		logging.SetAPIKey(r, authenticated.Prefix)
+
+		if !authenticated.HasScope(scope) {
+			metrics.AuthFailures.WithLabelValues(metrics.AuthForbidden).Inc()
+			h.writeAuthError(w, r, http.StatusForbidden, codeForbidden,
+				fmt.Sprintf("API key lacks the %s scope", scope))
+			return
+		}
+
+		next(w, r.WithContext(apikey.NewContext(r.Context(), authenticated)))
+	}
+}
+
+// writeAuthError rejects a request as JSON on the API and as a page elsewhere
+func (h *Handler) writeAuthError(w http.ResponseWriter, r *http.Request, statusCode int, code, message string) {
+	if statusCode == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="urlshortener"`)
+	}
+
+	if isAPIRequest(r) {
+		writeAPIError(w, statusCode, code, message)
+		return
+	}
+	h.renderError(w, message, statusCode)
+}
+
+// isAPIRequest reports whether a request is for the JSON API
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// apiKey returns the API key sent as a bearer token or in X-API-Key
+func apiKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
@@ -4,31 +4,64 @@ import (
 	"html/template"
 	"net/http"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 
+	"github.com/ItsDobiel/URLShortener/internal/accounts"
+	"github.com/ItsDobiel/URLShortener/internal/analytics"
+	"github.com/ItsDobiel/URLShortener/internal/apikey"
+	"github.com/ItsDobiel/URLShortener/internal/clientip"
 	"github.com/ItsDobiel/URLShortener/internal/config"
+	"github.com/ItsDobiel/URLShortener/internal/logging"
+	"github.com/ItsDobiel/URLShortener/internal/metrics"
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/ratelimit"
 	"github.com/ItsDobiel/URLShortener/internal/shortener"
 )
 
 // Handler manages HTTP requests
 type Handler struct {
 	shortener *shortener.Service
+	analytics *analytics.Tracker
 	config    *config.Config
 	templates *template.Template
+	clientIP  *clientip.Resolver
+	auth      *apikey.Authenticator
+	accounts  *accounts.Service
+
+	// Rate limiters for link creation and redirects, nil when disabled
+	shortenLimiter  *ratelimit.Limiter
+	redirectLimiter *ratelimit.Limiter
+
+	// draining is set once graceful shutdown begins
+	draining atomic.Bool
 }
 
 // NewHandler creates a new handler instance
-func NewHandler(svc *shortener.Service, cfg *config.Config) (*Handler, error) {
+func NewHandler(svc *shortener.Service, tracker *analytics.Tracker, ips *clientip.Resolver,
+	auth *apikey.Authenticator, users *accounts.Service, cfg *config.Config) (*Handler, error) {
 	// Parse templates
 	tmpl, err := template.ParseGlob(filepath.Join(cfg.TemplatesDir, "*.html"))
 	if err != nil {
 		return nil, err
 	}
 
-	return &Handler{
+	h := &Handler{
 		shortener: svc,
+		analytics: tracker,
 		config:    cfg,
 		templates: tmpl,
-	}, nil
+		clientIP:  ips,
+		auth:      auth,
+		accounts:  users,
+	}
+	if cfg.ShortenRateLimit > 0 {
+		h.shortenLimiter = ratelimit.New(cfg.ShortenRateLimit, cfg.ShortenRateBurst)
+	}
+	if cfg.RedirectRateLimit > 0 {
+		h.redirectLimiter = ratelimit.New(cfg.RedirectRateLimit, cfg.RedirectRateBurst)
+	}
+	return h, nil
 }
 
 // HomeHandler displays the main page
@@ -38,10 +71,7 @@ func (h *Handler) HomeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := h.templates.ExecuteTemplate(w, "index.html", nil); err != nil {
-		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-	}
+	h.renderPage(w, r, "index.html", http.StatusOK, nil)
 }
 
 // ShortenHandler processes URL shortening requests
@@ -51,6 +81,11 @@ func (h *Handler) ShortenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.rateLimited(w, r, h.shortenLimiter, "shorten") {
+		h.renderError(w, "Too many links created, please try again later", http.StatusTooManyRequests)
+		return
+	}
+
 	// Parse form data
 	if err := r.ParseForm(); err != nil {
 		h.renderError(w, "Invalid form data", http.StatusBadRequest)
@@ -63,26 +98,44 @@ func (h *Handler) ShortenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Shorten the URL
-	shortCode, err := h.shortener.ShortenURL(originalURL)
+	ttl, err := parseTTL(r.FormValue("expires_in"))
 	if err != nil {
-		h.renderError(w, err.Error(), http.StatusBadRequest)
+		h.renderError(w, err.Error(), statusForError(err))
 		return
 	}
 
+	redirectStatus, err := parseRedirectStatus(r.FormValue("redirect_status"))
+	if err != nil {
+		h.renderError(w, err.Error(), statusForError(err))
+		return
+	}
+
+	// Shorten the URL, under a custom alias if one was given
+	urlModel, _, err := h.shortener.ShortenURL(originalURL, shortener.ShortenOptions{
+		Alias:              strings.TrimSpace(r.FormValue("alias")),
+		TTL:                ttl,
+		RedirectStatus:     redirectStatus,
+		KeepTrackingParams: r.FormValue("keep_tracking_params") != "",
+		OwnerID:            h.userID(r),
+	})
+	if err != nil {
+		h.renderError(w, err.Error(), statusForError(err))
+		return
+	}
+
+	logging.SetShortCode(r, urlModel.ShortCode)
+
 	// Build short URL
-	shortURL := h.config.GetShortURL(shortCode)
+	shortURL := h.config.GetShortURL(urlModel.ShortCode)
 
 	// Render success response
 	data := map[string]any{
 		"ShortURL":    shortURL,
 		"OriginalURL": originalURL,
+		"ExpiresAt":   urlModel.ExpiresAt,
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := h.templates.ExecuteTemplate(w, "index.html", data); err != nil {
-		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-	}
+	h.renderPage(w, r, "index.html", http.StatusOK, data)
 }
 
 // RedirectHandler handles short code redirects
@@ -100,15 +153,60 @@ func (h *Handler) RedirectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	logging.SetShortCode(r, shortCode)
+
+	if h.rateLimited(w, r, h.redirectLimiter, "redirect") {
+		h.renderError(w, "Too many requests, please try again later", http.StatusTooManyRequests)
+		return
+	}
+
 	// Get original URL
-	originalURL, err := h.shortener.GetOriginalURL(shortCode)
+	urlModel, err := h.shortener.GetURL(shortCode)
 	if err != nil {
-		h.renderError(w, "Short code not found", http.StatusNotFound)
+		metrics.Redirects.WithLabelValues(metrics.ResultMiss).Inc()
+		switch shortener.ErrorCode(err) {
+		case shortener.CodeExpired:
+			h.renderError(w, "This short link has expired", http.StatusGone)
+		case "":
+			h.renderError(w, "Failed to look up short code", http.StatusInternalServerError)
+		default:
+			h.renderError(w, "Short code not found", http.StatusNotFound)
+		}
+		return
+	}
+
+	if urlModel.IsDisabled() {
+		metrics.Redirects.WithLabelValues(metrics.ResultDisabled).Inc()
+		h.renderDisabled(w, urlModel)
 		return
 	}
 
-	// Redirect to original URL
-	http.Redirect(w, r, originalURL, http.StatusFound)
+	metrics.Redirects.WithLabelValues(metrics.ResultHit).Inc()
+	h.analytics.Track(r, shortCode)
+
+	// Redirect to original URL, with the link's own status code if it has one
+	http.Redirect(w, r, urlModel.OriginalURL, h.config.RedirectStatus(urlModel.RedirectStatus))
+}
+
+// renderDisabled displays the page of a disabled link
+func (h *Handler) renderDisabled(w http.ResponseWriter, urlModel *models.URL) {
+	statusCode := h.config.DisabledStatus(urlModel.DisabledStatus)
+	message := urlModel.DisabledReason
+	if message == "" {
+		message = h.config.DisabledLinkMessage
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+
+	data := map[string]any{
+		"Message":    message,
+		"StatusCode": statusCode,
+		"Legal":      statusCode == http.StatusUnavailableForLegalReasons,
+	}
+	if err := h.templates.ExecuteTemplate(w, "disabled.html", data); err != nil {
+		http.Error(w, message, statusCode)
+	}
 }
 
 // renderError displays an error page
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds how long the readiness checks may take
+const readinessTimeout = 2 * time.Second
+
+// healthResponse is the body of the health endpoints
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthzHandler reports that the process is alive
+// It checks nothing else, so that a slow database never gets the process restarted
+func (h *Handler) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// ReadyzHandler reports whether the server can take traffic
+// It answers 503 once shutdown has begun or when any check fails
+func (h *Handler) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]string{
+		"database":  "ok",
+		"templates": "ok",
+		"shutdown":  "ok",
+	}
+	ready := true
+
+	if err := h.shortener.Ping(ctx); err != nil {
+		checks["database"] = err.Error()
+		ready = false
+	}
+
+	for _, name := range []string{"index.html", "error.html", "login.html", "register.html", "links.html", "link.html", "disabled.html"} {
+		if h.templates.Lookup(name) == nil {
+			checks["templates"] = name + " is not loaded"
+			ready = false
+		}
+	}
+
+	if h.draining.Load() {
+		checks["shutdown"] = "server is shutting down"
+		ready = false
+	}
+
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Checks: checks})
+		return
+	}
+	writeJSON(w, http.StatusOK, healthResponse{Status: "ready", Checks: checks})
+}
+
+// SetDraining makes the readiness check fail from now on, so that load
+// balancers stop sending traffic before the server shuts down
+func (h *Handler) SetDraining() {
+	h.draining.Store(true)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/ItsDobiel/URLShortener/internal/apikey"
+	"github.com/ItsDobiel/URLShortener/internal/metrics"
+	"github.com/ItsDobiel/URLShortener/internal/ratelimit"
+)
+
+// rateLimited takes a token for the client of r from limiter
+// When none is left it sets Retry-After and returns true, the caller then
+// writes the 429 response in its own format
+func (h *Handler) rateLimited(w http.ResponseWriter, r *http.Request, limiter *ratelimit.Limiter, name string) bool {
+	if limiter == nil {
+		return false
+	}
+
+	allowed, retryAfter := limiter.Allow(h.rateLimitKey(r))
+	if allowed {
+		return false
+	}
+
+	metrics.RateLimited.WithLabelValues(name).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return true
+}
+
+// rateLimitKey identifies the client of a request: its API key when it
+// authenticated with one, so that every key gets its own quota, and its IP otherwise
+func (h *Handler) rateLimitKey(r *http.Request) string {
+	if key := apikey.FromContext(r.Context()); key != nil {
+		return "key:" + strconv.FormatUint(uint64(key.ID), 10)
+	}
+	return "ip:" + h.clientIP.IP(r)
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds incoming request IDs so they can't bloat the logs
+const maxRequestIDLength = 128
+
+type contextKey struct{}
+
+// requestInfo is what handlers can add to the access log entry of a request
+type requestInfo struct {
+	id        string
+	shortCode string
+	apiKey    string
+}
+
+// AccessLog logs one line per request with its method, path, status, size,
+// duration, request ID, and the short code it was about and the API key it
+// came with, if any
+// Requests for the quiet paths, such as health probes, are logged at debug level
+func AccessLog(logger *slog.Logger, next http.Handler, quiet ...string) http.Handler {
+	quietPaths := make(map[string]bool, len(quiet))
+	for _, path := range quiet {
+		quietPaths[path] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Keep the caller's ID so that requests can be traced across services
+		info := &requestInfo{id: r.Header.Get(RequestIDHeader)}
+		if !validRequestID(info.id) {
+			info.id = rand.Text()
+		}
+		w.Header().Set(RequestIDHeader, info.id)
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), contextKey{}, info)))
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case quietPaths[r.URL.Path]:
+			level = slog.LevelDebug
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", info.id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if info.shortCode != "" {
+			attrs = append(attrs, slog.String("short_code", info.shortCode))
+		}
+		if info.apiKey != "" {
+			attrs = append(attrs, slog.String("api_key", info.apiKey))
+		}
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// SetShortCode records the short code a request was about in its access log entry
+func SetShortCode(r *http.Request, shortCode string) {
+	if info, ok := r.Context().Value(contextKey{}).(*requestInfo); ok {
+		info.shortCode = shortCode
+	}
+}
+
+// SetAPIKey records the prefix of the API key a request came with in its access log entry
+func SetAPIKey(r *http.Request, prefix string) {
+	if info, ok := r.Context().Value(contextKey{}).(*requestInfo); ok {
+		info.apiKey = prefix
+	}
+}
+
+// validRequestID accepts short IDs made of printable ASCII without spaces
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// responseRecorder captures the status code and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serve runs one request through AccessLog and decodes the entries it logged at info level
+func serve(t *testing.T, r *http.Request, next http.HandlerFunc) (*httptest.ResponseRecorder, []map[string]any) {
+	t.Helper()
+
+	var out bytes.Buffer
+	logger, err := New(&out, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	AccessLog(logger, next, "/healthz", "/metrics").ServeHTTP(w, r)
+
+	var entries []map[string]any
+	for line := range strings.Lines(out.String()) {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return w, entries
+}
+
+func TestAccessLogRequestID(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	tests := []struct {
+		name     string
+		incoming string
+		kept     bool
+	}{
+		{"caller's ID", "trace-123", true},
+		{"no ID", "", false},
+		{"ID with spaces", "trace 123", false},
+		{"ID too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/abcd123", nil)
+		if tt.incoming != "" {
+			r.Header.Set(RequestIDHeader, tt.incoming)
+		}
+		w, entries := serve(t, r, ok)
+
+		id := w.Header().Get(RequestIDHeader)
+		if kept := id == tt.incoming; kept != tt.kept || id == "" {
+			t.Errorf("%s: response ID = %q, want the caller's ID kept %v", tt.name, id, tt.kept)
+		}
+		if len(entries) != 1 || entries[0]["request_id"] != id {
+			t.Errorf("%s: logged %v, want one entry with request ID %q", tt.name, entries, id)
+		}
+	}
+}
+
+func TestAccessLogStatusAndSize(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/links", nil)
+	_, entries := serve(t, r, func(w http.ResponseWriter, r *http.Request) {
+		SetShortCode(r, "abcd123")
+		SetAPIKey(r, "usk_abcd")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+		// A second status is ignored by net/http and must not be logged either
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	if len(entries) != 1 {
+		t.Fatalf("logged %v, want one entry", entries)
+	}
+	entry := entries[0]
+	want := map[string]any{
+		"level":      "INFO",
+		"method":     "POST",
+		"path":       "/api/v1/links",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(len("created")),
+		"short_code": "abcd123",
+		"api_key":    "usk_abcd",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+}
+
+func TestAccessLogQuietPaths(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+		logged bool
+	}{
+		{"/healthz", http.StatusOK, false},
+		{"/metrics", http.StatusOK, false},
+		{"/healthz", http.StatusInternalServerError, true},
+		{"/abcd123", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		_, entries := serve(t, r, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		})
+		if logged := len(entries) > 0; logged != tt.logged {
+			t.Errorf("%s answering %d: logged %v at info level, want %v", tt.path, tt.status, entries, tt.logged)
+		}
+	}
+}
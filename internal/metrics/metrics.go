@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes of a shorten request
+const (
+	OutcomeCreated      = "created"
+	OutcomeDeduplicated = "deduplicated"
+	OutcomeInvalid      = "invalid"
+	OutcomeError        = "error"
+)
+
+// Results of a redirect
+const (
+	ResultHit      = "hit"
+	ResultMiss     = "miss"
+	ResultDisabled = "disabled"
+)
+
+// Reasons an API key is turned away
+const (
+	AuthMissing   = "missing"
+	AuthInvalid   = "invalid"
+	AuthRevoked   = "revoked"
+	AuthForbidden = "forbidden"
+)
+
+// Registry holds every metric exposed on /metrics
+// A dedicated registry keeps third party packages from adding their own
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// ShortenRequests counts shorten requests by outcome
+	ShortenRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_shorten_requests_total",
+		Help: "Shorten requests by outcome: created, deduplicated, invalid or error.",
+	}, []string{"outcome"})
+
+	// Redirects counts redirect lookups by result
+	Redirects = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_redirects_total",
+		Help: "Redirect lookups by result: hit, miss or disabled.",
+	}, []string{"result"})
+
+	// CollisionRetries counts generated short codes that were taken or reserved
+	CollisionRetries = factory.NewCounter(prometheus.CounterOpts{
+		Name: "urlshortener_collision_retries_total",
+		Help: "Generated short codes that had to be retried because they were taken or reserved.",
+	})
+
+	// CodeLengthEscalations counts short codes that had to grow past the
+	// configured length, by the length they grew to
+	CodeLengthEscalations = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_code_length_escalations_total",
+		Help: "Short code generations that moved on to a longer length because every shorter code tried was taken, by length.",
+	}, []string{"length"})
+
+	// RateLimited counts requests rejected by a rate limit
+	RateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_rate_limited_total",
+		Help: "Requests rejected with 429 by rate limit: shorten or redirect.",
+	}, []string{"limit"})
+
+	// AuthFailures counts requests rejected for their API key
+	AuthFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_auth_failures_total",
+		Help: "Requests rejected for their API key by reason: missing, invalid, revoked or forbidden.",
+	}, []string{"reason"})
+
+	// RequestDuration observes request latency per handler
+	RequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "urlshortener_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by handler.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Instrument wraps a handler so that its latency is observed under name
+func Instrument(name string, handler http.Handler) http.Handler {
+	observer := RequestDuration.MustCurryWith(prometheus.Labels{"handler": name})
+	return promhttp.InstrumentHandlerDuration(observer, handler)
+}
+
+// NewCounterFunc exposes a counter whose value is read from fn on every scrape
+func NewCounterFunc(name, help string, fn func() float64) {
+	factory.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, fn)
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// APIKey identifies a programmatic client
+// Only a hash of the key is stored, the key itself is shown once when minted
+type APIKey struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"not null;size:100"`
+	// Prefix is the start of the key, kept in the clear so keys can be told apart
+	Prefix  string `gorm:"uniqueIndex;not null;size:16"`
+	KeyHash string `gorm:"uniqueIndex;not null;size:64"`
+	// Scopes is the comma separated list of what the key may do
+	Scopes string `gorm:"not null;size:255"`
+	// UserID is the user whose links the key manages, nil for keys of anonymous clients
+	UserID     *uint `gorm:"index"`
+	User       *User `gorm:"constraint:OnDelete:CASCADE"`
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	// RevokedAt is nil for keys that are still valid
+	RevokedAt *time.Time
+}
+
+// TableName specifies the table name for the APIKey model
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList returns the scopes of the key
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// HasScope reports whether the key grants scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.ScopeList(), scope)
+}
+
+// IsRevoked reports whether the key has been revoked
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
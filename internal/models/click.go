@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Click records a single redirect through a short link
+type Click struct {
+	ID        uint      `gorm:"primaryKey"`
+	ShortCode string    `gorm:"index;not null;size:20"`
+	ClickedAt time.Time `gorm:"not null"`
+	// Day is the UTC date of the click, stored so that every database can group by it
+	Day string `gorm:"index;not null;size:10"`
+	// Referrer is the host of the referring page, empty for direct visits
+	Referrer  string `gorm:"size:255"`
+	UserAgent string `gorm:"size:512"`
+	UAFamily  string `gorm:"size:32"`
+	// IPHash is a salted hash of the client IP, the IP itself is never stored
+	IPHash string `gorm:"size:64"`
+}
+
+// TableName specifies the table name for the Click model
+func (Click) TableName() string {
+	return "clicks"
+}
+
+// ClickStats holds the aggregated clicks of one short link
+type ClickStats struct {
+	ShortCode     string       `json:"short_code"`
+	TotalClicks   int64        `json:"total_clicks"`
+	ClicksPerDay  []DayCount   `json:"clicks_per_day"`
+	TopReferrers  []ValueCount `json:"top_referrers"`
+	TopUserAgents []ValueCount `json:"top_user_agents"`
+}
+
+// DayCount is the number of clicks on one day
+type DayCount struct {
+	Day    string `json:"day"`
+	Clicks int64  `json:"clicks"`
+}
+
+// ValueCount is the number of clicks sharing a value, such as a referrer
+type ValueCount struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
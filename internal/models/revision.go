@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// LinkRevision records one change of a link's destination
+// Revisions are never updated, they are removed together with their link
+type LinkRevision struct {
+	ID     uint `gorm:"primaryKey"`
+	LinkID uint `gorm:"uniqueIndex:idx_link_revisions_number;not null"`
+	Link   *URL `gorm:"constraint:OnDelete:CASCADE"`
+	// Number counts the revisions of a link, starting at 1
+	Number      int    `gorm:"uniqueIndex:idx_link_revisions_number;not null"`
+	PreviousURL string `gorm:"not null;size:2048"`
+	NewURL      string `gorm:"not null;size:2048"`
+	// RestoredFrom is the revision whose destination was restored, 0 for the
+	// original destination and nil for revisions that weren't a restore
+	RestoredFrom *int
+	// EditorID is the user who made the change, nil once they are deleted
+	EditorID  *uint `gorm:"index"`
+	Editor    *User `gorm:"constraint:OnDelete:SET NULL"`
+	CreatedAt time.Time
+}
+
+// TableName specifies the table name for the LinkRevision model
+func (LinkRevision) TableName() string {
+	return "link_revisions"
+}
@@ -1,14 +1,94 @@
 package models
 
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
 // URL represents a shortened URL mapping in the database
 type URL struct {
 	ID            uint   `gorm:"primaryKey"`
 	ShortCode     string `gorm:"uniqueIndex;not null;size:20"`
 	OriginalURL   string `gorm:"not null;size:2048"`
-	NormalizedURL string `gorm:"uniqueIndex;not null;size:2048"`
+	NormalizedURL string `gorm:"index;not null;size:2048"`
+	// DedupKey is set for links that are reused by whoever shortens the same
+	// URL again, the normalized URL prefixed by the owner for owned links,
+	// and left empty for custom aliases, which are never reused
+	DedupKey *string `gorm:"uniqueIndex;size:2080"`
+	// OwnerID is the user who created the link, nil for anonymous links
+	OwnerID   *uint `gorm:"index"`
+	Owner     *User `gorm:"constraint:OnDelete:SET NULL"`
+	CreatedAt time.Time
+	// ExpiresAt is nil for links that never expire
+	ExpiresAt *time.Time `gorm:"index"`
+	// RedirectStatus overrides the default redirect status code, 0 keeps the default
+	RedirectStatus int `gorm:"not null;default:0"`
+	// DisabledAt is set while the link is disabled, its redirect then answers
+	// DisabledStatus, 0 for the default, with DisabledReason
+	DisabledAt     *time.Time
+	DisabledStatus int    `gorm:"not null;default:0"`
+	DisabledReason string `gorm:"size:255"`
+	// DeletedAt is set once the link is deleted, the row keeps its short code
+	// taken for good: purging only clears its destination, leaving a tombstone
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 // TableName specifies the table name for the URL model
 func (URL) TableName() string {
 	return "urls"
 }
+
+// IsOwnedBy reports whether the link belongs to the user with the given ID
+func (u *URL) IsOwnedBy(userID uint) bool {
+	return u.OwnerID != nil && *u.OwnerID == userID
+}
+
+// IsDisabled reports whether the link has been disabled
+func (u *URL) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// IsDeleted reports whether the link has been deleted
+func (u *URL) IsDeleted() bool {
+	return u.DeletedAt.Valid
+}
+
+// IsPurged reports whether only the tombstone of a deleted link is left
+func (u *URL) IsPurged() bool {
+	return u.IsDeleted() && u.OriginalURL == ""
+}
+
+// IsExpired reports whether the link has expired at the given time
+func (u *URL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
+}
+
+// ArchivedURL keeps a copy of an expired link after it has been swept
+type ArchivedURL struct {
+	ID          uint   `gorm:"primaryKey"`
+	ShortCode   string `gorm:"index;not null;size:20"`
+	OriginalURL string `gorm:"not null;size:2048"`
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	ArchivedAt  time.Time
+}
+
+// TableName specifies the table name for the ArchivedURL model
+func (ArchivedURL) TableName() string {
+	return "archived_urls"
+}
+
+// Archive copies an expired link into its archived form
+func (u *URL) Archive(archivedAt time.Time) ArchivedURL {
+	archived := ArchivedURL{
+		ShortCode:   u.ShortCode,
+		OriginalURL: u.OriginalURL,
+		CreatedAt:   u.CreatedAt,
+		ArchivedAt:  archivedAt,
+	}
+	if u.ExpiresAt != nil {
+		archived.ExpiresAt = *u.ExpiresAt
+	}
+	return archived
+}
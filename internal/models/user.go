@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// User is an account that owns links
+type User struct {
+	ID    uint   `gorm:"primaryKey"`
+	Email string `gorm:"uniqueIndex;not null;size:254"`
+	// PasswordHash is the bcrypt hash of the password
+	PasswordHash string `gorm:"not null;size:60"`
+	CreatedAt    time.Time
+}
+
+// TableName specifies the table name for the User model
+func (User) TableName() string {
+	return "users"
+}
+
+// Session keeps a user logged in between requests
+// Only a hash of the session token is stored, the token lives in a cookie
+type Session struct {
+	ID        uint   `gorm:"primaryKey"`
+	TokenHash string `gorm:"uniqueIndex;not null;size:64"`
+	UserID    uint   `gorm:"index;not null"`
+	User      User   `gorm:"constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+// TableName specifies the table name for the Session model
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsExpired reports whether the session has expired at the given time
+func (s *Session) IsExpired(now time.Time) bool {
+	return !s.ExpiresAt.After(now)
+}
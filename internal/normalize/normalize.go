@@ -0,0 +1,331 @@
+package normalize
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Rule names, as used in the NORMALIZE_RULES setting
+const (
+	RuleLowercase       = "lowercase"
+	RuleTrailingSlash   = "trailing_slash"
+	RuleDefaultPort     = "default_port"
+	RuleDotSegments     = "dot_segments"
+	RulePercentEncoding = "percent_encoding"
+	RuleSortQuery       = "sort_query"
+	RuleIDN             = "idn"
+)
+
+// AllRules lists every rule in the order they are applied
+var AllRules = []string{
+	RuleLowercase,
+	RuleIDN,
+	RuleDefaultPort,
+	RulePercentEncoding,
+	RuleDotSegments,
+	RuleTrailingSlash,
+	RuleSortQuery,
+}
+
+// Rules selects the normalization steps a Normalizer applies
+type Rules struct {
+	// Lowercase lowercases the scheme and host
+	Lowercase bool
+
+	// IDN converts internationalized host names to punycode
+	IDN bool
+
+	// DefaultPort drops :80 from http and :443 from https URLs
+	DefaultPort bool
+
+	// PercentEncoding uppercases percent escapes and decodes the ones of unreserved characters
+	PercentEncoding bool
+
+	// DotSegments resolves "." and ".." segments in the path
+	DotSegments bool
+
+	// TrailingSlash drops the trailing slash of non-root paths
+	TrailingSlash bool
+
+	// SortQuery orders query parameters by name
+	SortQuery bool
+
+	// TrackingParams are the query parameters removed by StripTracking
+	// A trailing * matches every parameter starting with the rest, as in utm_*
+	TrackingParams []string
+}
+
+// DefaultTrackingParams are the tracking parameters added by common
+// analytics, advertising and newsletter tools
+var DefaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "twclid",
+	"ttclid", "li_fat_id", "igshid", "yclid", "mc_cid", "mc_eid", "_hsenc", "_hsmi", "mkt_tok",
+}
+
+// ParseRules enables the named rules
+func ParseRules(names []string) (Rules, error) {
+	var rules Rules
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case RuleLowercase:
+			rules.Lowercase = true
+		case RuleIDN:
+			rules.IDN = true
+		case RuleDefaultPort:
+			rules.DefaultPort = true
+		case RulePercentEncoding:
+			rules.PercentEncoding = true
+		case RuleDotSegments:
+			rules.DotSegments = true
+		case RuleTrailingSlash:
+			rules.TrailingSlash = true
+		case RuleSortQuery:
+			rules.SortQuery = true
+		default:
+			return Rules{}, fmt.Errorf("unknown normalization rule %q, must be one of %s",
+				name, strings.Join(AllRules, ", "))
+		}
+	}
+	return rules, nil
+}
+
+// Normalizer converts URLs to a canonical form so that equivalent URLs
+// can be recognised as duplicates
+type Normalizer struct {
+	rules Rules
+}
+
+// New creates a normalizer applying the given rules
+func New(rules Rules) *Normalizer {
+	return &Normalizer{rules: rules}
+}
+
+// Normalize returns the canonical form of rawURL
+// URLs that can't be parsed are returned unchanged
+func (n *Normalizer) Normalize(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	if n.rules.Lowercase {
+		parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+		parsedURL.Host = strings.ToLower(parsedURL.Host)
+	}
+
+	if n.rules.IDN {
+		if host, err := ASCIIHost(parsedURL.Hostname()); err == nil {
+			parsedURL.Host = joinHostPort(host, parsedURL.Port())
+		}
+	}
+
+	if n.rules.DefaultPort && parsedURL.Port() == defaultPorts[strings.ToLower(parsedURL.Scheme)] {
+		parsedURL.Host = joinHostPort(parsedURL.Hostname(), "")
+	}
+
+	path := parsedURL.EscapedPath()
+	if n.rules.PercentEncoding {
+		path = normalizeEscapes(path)
+		parsedURL.RawQuery = normalizeEscapes(parsedURL.RawQuery)
+	}
+	if n.rules.DotSegments {
+		path = removeDotSegments(path)
+	}
+	if n.rules.TrailingSlash && len(path) > 1 && strings.HasSuffix(path, "/") {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if path == "" {
+		path = "/"
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		parsedURL.Path, parsedURL.RawPath = unescaped, path
+	}
+
+	if n.rules.SortQuery {
+		parsedURL.RawQuery = sortQuery(parsedURL.RawQuery)
+	}
+
+	return parsedURL.String()
+}
+
+// StripTracking removes the tracking parameters from the query of rawURL
+// URLs without any are returned unchanged, byte for byte
+func (n *Normalizer) StripTracking(rawURL string) string {
+	if len(n.rules.TrackingParams) == 0 {
+		return rawURL
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.RawQuery == "" {
+		return rawURL
+	}
+
+	var kept []string
+	stripped := false
+	for param := range strings.SplitSeq(parsedURL.RawQuery, "&") {
+		if n.isTrackingParam(paramName(param)) {
+			stripped = true
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if !stripped {
+		return rawURL
+	}
+
+	parsedURL.RawQuery = strings.Join(kept, "&")
+	return parsedURL.String()
+}
+
+// isTrackingParam reports whether a raw parameter name is a tracking parameter
+func (n *Normalizer) isTrackingParam(rawName string) bool {
+	name, err := url.QueryUnescape(rawName)
+	if err != nil {
+		name = rawName
+	}
+	name = strings.ToLower(name)
+
+	for _, pattern := range n.rules.TrackingParams {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// ASCIIHost converts an internationalized host name to punycode
+// IP addresses and ASCII names are returned lowercased
+func ASCIIHost(host string) (string, error) {
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	return idna.Lookup.ToASCII(host)
+}
+
+// defaultPorts maps schemes to the port they use when none is given
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// joinHostPort rebuilds a URL host, bracketing IPv6 addresses
+func joinHostPort(host, port string) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port == "" {
+		return host
+	}
+	return host + ":" + port
+}
+
+// normalizeEscapes uppercases the hex digits of percent escapes and decodes
+// those of unreserved characters, which never need escaping (RFC 3986 6.2.2)
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// removeDotSegments resolves "." and ".." segments (RFC 3986 5.2.4)
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			// The leading empty segment of an absolute path is never removed
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+	return strings.Join(output, "/")
+}
+
+// sortQuery orders query parameters by name, keeping the order of
+// repeated names since it can be significant, and drops empty ones
+func sortQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params []string
+	for param := range strings.SplitSeq(rawQuery, "&") {
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return paramName(params[i]) < paramName(params[j])
+	})
+	return strings.Join(params, "&")
+}
+
+// paramName returns the name of a raw query parameter
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	return name
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,102 @@
+package normalize
+
+import "testing"
+
+func TestNormalizeRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+		in    string
+		want  string
+	}{
+		{"no rules", Rules{}, "HTTP://Example.COM:80/a/./b/?b=2&a=1", "http://Example.COM:80/a/./b/?b=2&a=1"},
+		{"no rules root path", Rules{}, "https://example.com", "https://example.com/"},
+
+		{"lowercase scheme and host", Rules{Lowercase: true}, "HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"lowercase keeps path and query", Rules{Lowercase: true}, "https://example.com/A?Q=B", "https://example.com/A?Q=B"},
+
+		{"idn host", Rules{IDN: true}, "https://bücher.example/", "https://xn--bcher-kva.example/"},
+		{"idn host with port", Rules{IDN: true}, "https://bücher.example:8443/", "https://xn--bcher-kva.example:8443/"},
+		{"idn ascii host", Rules{IDN: true}, "https://example.com/", "https://example.com/"},
+
+		{"default http port", Rules{DefaultPort: true}, "http://example.com:80/", "http://example.com/"},
+		{"default https port", Rules{DefaultPort: true}, "https://example.com:443/", "https://example.com/"},
+		{"https on port 80", Rules{DefaultPort: true}, "https://example.com:80/", "https://example.com:80/"},
+		{"other port", Rules{DefaultPort: true}, "http://example.com:8080/", "http://example.com:8080/"},
+		{"default port uppercase scheme", Rules{DefaultPort: true}, "HTTP://example.com:80/", "http://example.com/"},
+		{"default port ipv6", Rules{DefaultPort: true}, "http://[::1]:80/", "http://[::1]/"},
+
+		{"uppercase escapes", Rules{PercentEncoding: true}, "https://example.com/a%2fb?q=%e2%82%ac", "https://example.com/a%2Fb?q=%E2%82%AC"},
+		{"decode unreserved", Rules{PercentEncoding: true}, "https://example.com/%7Euser/%41", "https://example.com/~user/A"},
+
+		{"dot segments", Rules{DotSegments: true}, "https://example.com/a/./b/../c", "https://example.com/a/c"},
+		{"dot segments above root", Rules{DotSegments: true}, "https://example.com/../a", "https://example.com/a"},
+
+		{"trailing slash", Rules{TrailingSlash: true}, "https://example.com/a/", "https://example.com/a"},
+		{"trailing slash root", Rules{TrailingSlash: true}, "https://example.com/", "https://example.com/"},
+
+		{"sort query", Rules{SortQuery: true}, "https://example.com/?b=2&a=1&c=3", "https://example.com/?a=1&b=2&c=3"},
+		{"sort query keeps repeated values in order", Rules{SortQuery: true}, "https://example.com/?b=1&a=2&b=0", "https://example.com/?a=2&b=1&b=0"},
+		{"sort query empty", Rules{SortQuery: true}, "https://example.com/", "https://example.com/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.rules).Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripTracking(t *testing.T) {
+	n := New(Rules{TrackingParams: DefaultTrackingParams})
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"no query", "https://example.com/", "https://example.com/"},
+		{"no tracking params", "https://example.com/?b=2&a=1", "https://example.com/?b=2&a=1"},
+		{"prefix pattern", "https://example.com/?utm_source=mail&utm_medium=x", "https://example.com/"},
+		{"exact names", "https://example.com/?id=1&fbclid=abc&gclid=def", "https://example.com/?id=1"},
+		{"case insensitive", "https://example.com/?UTM_Source=mail&id=1", "https://example.com/?id=1"},
+		{"escaped name", "https://example.com/?utm%5Fsource=mail&id=1", "https://example.com/?id=1"},
+		{"keeps order and fragment", "https://example.com/?b=2&fbclid=x&a=1#top", "https://example.com/?b=2&a=1#top"},
+		{"prefix is not a name", "https://example.com/?fbclidx=1", "https://example.com/?fbclidx=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.StripTracking(tt.in); got != tt.want {
+				t.Errorf("StripTracking(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	if got := New(Rules{}).StripTracking("https://example.com/?utm_source=mail"); got != "https://example.com/?utm_source=mail" {
+		t.Errorf("StripTracking without tracking params = %q, want the URL unchanged", got)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]string{"Lowercase", "default_port", "sort_query"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Rules{Lowercase: true, DefaultPort: true, SortQuery: true}); !equalRules(rules, want) {
+		t.Errorf("ParseRules = %+v, want %+v", rules, want)
+	}
+
+	if _, err := ParseRules([]string{"lowercase", "uppercase"}); err == nil {
+		t.Error("ParseRules accepted an unknown rule")
+	}
+}
+
+// equalRules compares the toggles of two rule sets
+func equalRules(a, b Rules) bool {
+	return a.Lowercase == b.Lowercase && a.IDN == b.IDN && a.DefaultPort == b.DefaultPort &&
+		a.PercentEncoding == b.PercentEncoding && a.DotSegments == b.DotSegments &&
+		a.TrailingSlash == b.TrailingSlash && a.SortQuery == b.SortQuery
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLimiter creates a limiter whose clock reads *now
+func newTestLimiter(perMinute, burst int, now *time.Time) *Limiter {
+	l := New(perMinute, burst)
+	l.now = func() time.Time { return *now }
+	l.lastPrune = *now
+	return l
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	now := time.Now()
+	l := newTestLimiter(60, 3, &now)
+
+	for i := range 3 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	if ok, wait := l.Allow("a"); ok || wait != time.Second {
+		t.Errorf("request past the burst = %v, wait %s, want refused for 1s", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another key shares the exhausted bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, wait := l.Allow("a"); ok || wait != 500*time.Millisecond {
+		t.Errorf("half a token later = %v, wait %s, want refused for 500ms", ok, wait)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("refilled token refused")
+	}
+
+	// A long idle period refills the bucket up to the burst only
+	now = now.Add(time.Hour)
+	for i := range 3 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d after idling refused", i+1)
+		}
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("bucket refilled past its burst")
+	}
+}
+
+func TestLimiterForgetsIdleBuckets(t *testing.T) {
+	now := time.Now()
+	l := newTestLimiter(1, 2, &now)
+
+	l.Allow("idle")
+	l.Allow("busy")
+	l.Allow("busy")
+
+	// A minute later idle is full again and busy has earned one of its two tokens
+	now = now.Add(pruneInterval)
+	l.Allow("other")
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("full bucket kept after pruning")
+	}
+	if b, ok := l.buckets["busy"]; !ok || b.tokens != 1 {
+		t.Errorf("partly refilled bucket = %+v, want it kept with one token", b)
+	}
+
+	// Buckets are only pruned once per interval
+	now = now.Add(pruneInterval / 2)
+	l.Allow("busy")
+	if _, ok := l.buckets["other"]; !ok {
+		t.Error("bucket pruned before the next interval")
+	}
+}
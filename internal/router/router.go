@@ -1,33 +1,123 @@
 package router
 
 import (
+	"log/slog"
 	"net/http"
+	"strings"
 
+	"github.com/ItsDobiel/URLShortener/internal/apikey"
 	"github.com/ItsDobiel/URLShortener/internal/handlers"
+	"github.com/ItsDobiel/URLShortener/internal/logging"
+	"github.com/ItsDobiel/URLShortener/internal/metrics"
+	"github.com/ItsDobiel/URLShortener/internal/shortener"
 )
 
+// router registers routes and reserves their first path segment
+// so that no short code can ever shadow them
+type router struct {
+	serveMux *http.ServeMux
+	reserved *shortener.ReservedWords
+}
+
 // SetupRouter configures and returns the HTTP router
-func SetupRouter(handler *handlers.Handler, templatesDir string) *http.ServeMux {
-	mux := http.NewServeMux()
+// The first path segment of every route is added to reserved, and every
+// request is written to the access log
+func SetupRouter(handler *handlers.Handler, templatesDir string, reserved *shortener.ReservedWords, logger *slog.Logger) http.Handler {
+	mux := &router{serveMux: http.NewServeMux(), reserved: reserved}
 
 	// Serve static files (In this case CSS files)
 	fs := http.FileServer(http.Dir(templatesDir + "/static"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	mux.Handle("/static/", metrics.Instrument("static", http.StripPrefix("/static/", fs)))
 
 	// Home page - displays the URL shortening form
+	home := metrics.Instrument("home", http.HandlerFunc(handler.HomeHandler))
+	redirect := metrics.Instrument("redirect", http.HandlerFunc(handler.RedirectHandler))
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// If path is exactly "/", show home page
 		if r.URL.Path == "/" {
-			handler.HomeHandler(w, r)
+			home.ServeHTTP(w, r)
 			return
 		}
 
 		// Otherwise, treat as short code redirect
-		handler.RedirectHandler(w, r)
+		redirect.ServeHTTP(w, r)
 	})
 
 	// Shorten endpoint - processes URL shortening requests
-	mux.HandleFunc("/shorten", handler.ShortenHandler)
+	mux.HandleInstrumented("/shorten", "shorten", handler.Authenticate(apikey.ScopeLinksCreate, handler.ShortenHandler))
+
+	// Accounts - registration, login and the links of the logged in user
+	mux.HandleInstrumented("/register", "register", handler.RegisterHandler)
+	mux.HandleInstrumented("/login", "login", handler.LoginHandler)
+	mux.HandleInstrumented("POST /logout", "logout", handler.LogoutHandler)
+	mux.HandleInstrumented("GET /links", "my_links", handler.MyLinksHandler)
+	mux.HandleInstrumented("GET /links/{code}", "my_link", handler.MyLinkHandler)
+	mux.HandleInstrumented("POST /links/{code}/edit", "edit_my_link", handler.EditMyLinkHandler)
+	mux.HandleInstrumented("POST /links/{code}/revisions/{revision}/restore", "restore_my_link", handler.RestoreMyLinkHandler)
+	mux.HandleInstrumented("POST /links/{code}/disable", "disable_my_link", handler.DisableMyLinkHandler)
+	mux.HandleInstrumented("POST /links/{code}/enable", "enable_my_link", handler.EnableMyLinkHandler)
+	mux.HandleInstrumented("POST /links/{code}/delete", "delete_my_link", handler.DeleteMyLinkHandler)
+
+	// JSON API - versioned endpoints for programmatic clients, each needing an API key scope
+	mux.HandleInstrumented("POST /api/v1/links", "api_create_link",
+		handler.Authenticate(apikey.ScopeLinksCreate, handler.APICreateLinkHandler))
+	mux.HandleInstrumented("GET /api/v1/links/{code}", "api_get_link",
+		handler.Authenticate(apikey.ScopeLinksRead, handler.APIGetLinkHandler))
+	mux.HandleInstrumented("PATCH /api/v1/links/{code}", "api_update_link",
+		handler.Authenticate(apikey.ScopeLinksUpdate, handler.APIUpdateLinkHandler))
+	mux.HandleInstrumented("GET /api/v1/links/{code}/revisions", "api_list_revisions",
+		handler.Authenticate(apikey.ScopeLinksRead, handler.APIListRevisionsHandler))
+	mux.HandleInstrumented("POST /api/v1/links/{code}/revisions/{revision}/restore", "api_restore_revision",
+		handler.Authenticate(apikey.ScopeLinksUpdate, handler.APIRestoreRevisionHandler))
+	mux.HandleInstrumented("POST /api/v1/links/{code}/disable", "api_disable_link",
+		handler.Authenticate(apikey.ScopeLinksUpdate, handler.APIDisableLinkHandler))
+	mux.HandleInstrumented("POST /api/v1/links/{code}/enable", "api_enable_link",
+		handler.Authenticate(apikey.ScopeLinksUpdate, handler.APIEnableLinkHandler))
+	mux.HandleInstrumented("DELETE /api/v1/links/{code}", "api_delete_link",
+		handler.Authenticate(apikey.ScopeLinksDelete, handler.APIDeleteLinkHandler))
+	mux.HandleInstrumented("GET /api/v1/links/{code}/stats", "api_link_stats",
+		handler.Authenticate(apikey.ScopeStatsRead, handler.APILinkStatsHandler))
+	mux.HandleInstrumented("/api/", "api_not_found", handler.APINotFoundHandler)
+
+	// Health probes for orchestrators
+	mux.HandleInstrumented("GET /healthz", "healthz", handler.HealthzHandler)
+	mux.HandleInstrumented("GET /readyz", "readyz", handler.ReadyzHandler)
+
+	// Prometheus metrics
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	// Probes and scrapes arrive every few seconds, only log them when debugging
+	return logging.AccessLog(logger, mux.serveMux, "/healthz", "/readyz", "/metrics")
+}
+
+// Handle registers a handler and reserves the pattern's first segment
+func (rt *router) Handle(pattern string, handler http.Handler) {
+	rt.serveMux.Handle(pattern, handler)
+	rt.reserve(pattern)
+}
+
+// HandleFunc registers a handler function and reserves the pattern's first segment
+func (rt *router) HandleFunc(pattern string, handler http.HandlerFunc) {
+	rt.serveMux.HandleFunc(pattern, handler)
+	rt.reserve(pattern)
+}
+
+// HandleInstrumented registers a handler function whose latency is
+// recorded under name, and reserves the pattern's first segment
+func (rt *router) HandleInstrumented(pattern, name string, handler http.HandlerFunc) {
+	rt.Handle(pattern, metrics.Instrument(name, handler))
+}
+
+// reserve adds the first literal path segment of a pattern to the reserved words
+// For example "POST /api/v1/links" reserves "api"
+func (rt *router) reserve(pattern string) {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
 
-	return mux
+	segment, _, _ := strings.Cut(strings.TrimPrefix(pattern, "/"), "/")
+	if segment == "" || strings.HasPrefix(segment, "{") {
+		return
+	}
+	rt.reserved.Add(segment)
 }
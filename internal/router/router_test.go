@@ -0,0 +1,266 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ItsDobiel/URLShortener/internal/accounts"
+	"github.com/ItsDobiel/URLShortener/internal/analytics"
+	"github.com/ItsDobiel/URLShortener/internal/apikey"
+	"github.com/ItsDobiel/URLShortener/internal/clientip"
+	"github.com/ItsDobiel/URLShortener/internal/config"
+	"github.com/ItsDobiel/URLShortener/internal/handlers"
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/normalize"
+	"github.com/ItsDobiel/URLShortener/internal/shortener"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+// testServer is the whole application on an in-memory store
+type testServer struct {
+	handler http.Handler
+	store   *store.MemoryStore
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	t.Setenv("DATABASE_DRIVER", "memory")
+	t.Setenv("TEMPLATES_DIR", "../../templates")
+	t.Setenv("SHORTEN_RATE_LIMIT", "0")
+	t.Setenv("REDIRECT_RATE_LIMIT", "0")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := store.NewMemoryStore()
+	generator, err := shortener.NewCodeGenerator(shortener.GeneratorHash, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved := shortener.NewReservedWords()
+	svc := shortener.NewService(links, shortener.Options{
+		CodeLength:       cfg.ShortCodeLength,
+		Generator:        generator,
+		MaxCodeLength:    cfg.MaxShortCodeLength,
+		CollisionRetries: cfg.CollisionRetries,
+		Reserved:         reserved,
+		Normalizer:       normalize.New(normalize.Rules{}),
+		SelfDomains:      []string{cfg.ShortDomain},
+	})
+
+	ips, err := clientip.NewResolver(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clicks := analytics.NewPipeline(links, analytics.PipelineOptions{
+		QueueSize: 10, Workers: 1, BatchSize: 10, FlushInterval: cfg.ClickFlushInterval, SampleRate: 1,
+	})
+	t.Cleanup(func() { clicks.Close(t.Context()) })
+
+	handler, err := handlers.NewHandler(svc, analytics.NewTracker(links, clicks, "", ips), ips,
+		apikey.NewAuthenticator(links), accounts.NewService(links, cfg.SessionTTL), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &testServer{handler: SetupRouter(handler, cfg.TemplatesDir, reserved, logger), store: links}
+}
+
+// do sends a request, with the API key when there is one, and returns the response
+func (s *testServer) do(t *testing.T, method, path, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	return w
+}
+
+// shorten creates a link and returns its short code
+func (s *testServer) shorten(t *testing.T, key, url string) string {
+	t.Helper()
+
+	w := s.do(t, http.MethodPost, "/api/v1/links", key, `{"url": "`+url+`"}`)
+	if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+		t.Fatalf("shortening %s answered %d: %s", url, w.Code, w.Body)
+	}
+
+	var link struct {
+		ShortCode string `json:"short_code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &link); err != nil {
+		t.Fatal(err)
+	}
+	return link.ShortCode
+}
+
+// mintKey stores a new API key with the given scopes and returns it
+func (s *testServer) mintKey(t *testing.T, userID *uint, scopes ...string) string {
+	t.Helper()
+
+	key, apiKey, err := apikey.Generate("test", scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey.UserID = userID
+	if err := s.store.CreateAPIKey(apiKey); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// createUser stores a user and returns its ID
+func (s *testServer) createUser(t *testing.T, email string) *uint {
+	t.Helper()
+
+	user := &models.User{Email: email, PasswordHash: "-"}
+	if err := s.store.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	return &user.ID
+}
+
+func TestChangingLinksNeedsAnAPIKey(t *testing.T) {
+	s := newTestServer(t)
+	code := s.shorten(t, "", "https://example.com/shared")
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPatch, "/api/v1/links/" + code, `{"url": "https://example.com/mine"}`},
+		{http.MethodPost, "/api/v1/links/" + code + "/revisions/0/restore", ""},
+		{http.MethodPost, "/api/v1/links/" + code + "/disable", `{"status": 451, "reason": "pwned"}`},
+		{http.MethodPost, "/api/v1/links/" + code + "/enable", ""},
+		{http.MethodDelete, "/api/v1/links/" + code, ""},
+	}
+	for _, tt := range tests {
+		if w := s.do(t, tt.method, tt.path, "", tt.body); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a key answered %d, want 401", tt.method, tt.path, w.Code)
+		}
+	}
+
+	// Reading stays open
+	if w := s.do(t, http.MethodGet, "/api/v1/links/"+code, "", ""); w.Code != http.StatusOK {
+		t.Errorf("GET without a key answered %d, want 200", w.Code)
+	}
+	if w := s.do(t, http.MethodGet, "/"+code, "", ""); w.Code != http.StatusFound {
+		t.Errorf("redirect answered %d, want 302", w.Code)
+	}
+}
+
+func TestOnlyAdminsManageAnonymousLinks(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser(t, "alice@example.com")
+	bob := s.createUser(t, "bob@example.com")
+
+	anonymous := s.shorten(t, "", "https://example.com/shared")
+	owned := s.shorten(t, s.mintKey(t, alice), "https://example.com/alice")
+
+	tests := []struct {
+		name string
+		key  string
+		code string
+		want int
+	}{
+		{"user key on an anonymous link", s.mintKey(t, bob), anonymous, http.StatusForbidden},
+		{"key without a user on an anonymous link", s.mintKey(t, nil), anonymous, http.StatusForbidden},
+		{"user key on another user's link", s.mintKey(t, bob), owned, http.StatusForbidden},
+		{"admin key on an anonymous link", s.mintKey(t, nil, apikey.ScopeAdmin), anonymous, http.StatusNoContent},
+		{"admin key on a user's link", s.mintKey(t, nil, apikey.ScopeAdmin), owned, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if w := s.do(t, http.MethodDelete, "/api/v1/links/"+tt.code, tt.key, ""); w.Code != tt.want {
+			t.Errorf("%s: DELETE answered %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+func TestOnlyAdminsDisableAnonymousLinks(t *testing.T) {
+	s := newTestServer(t)
+	bob := s.createUser(t, "bob@example.com")
+	code := s.shorten(t, "", "https://example.com/shared")
+	takedown := `{"status": 451, "reason": "pwned"}`
+
+	refused := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{"no key", "", http.StatusUnauthorized},
+		{"user key", s.mintKey(t, bob), http.StatusForbidden},
+		{"key without a user", s.mintKey(t, nil), http.StatusForbidden},
+	}
+	for _, tt := range refused {
+		if w := s.do(t, http.MethodPost, "/api/v1/links/"+code+"/disable", tt.key, takedown); w.Code != tt.want {
+			t.Errorf("%s: disable answered %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	if w := s.do(t, http.MethodGet, "/"+code, "", ""); w.Code != http.StatusFound {
+		t.Fatalf("redirect after refused disables answered %d, want 302", w.Code)
+	}
+
+	admin := s.mintKey(t, nil, apikey.ScopeAdmin)
+	if w := s.do(t, http.MethodPost, "/api/v1/links/"+code+"/disable", admin, takedown); w.Code != http.StatusOK {
+		t.Fatalf("disabling with an admin key answered %d, want 200: %s", w.Code, w.Body)
+	}
+	if w := s.do(t, http.MethodGet, "/"+code, "", ""); w.Code != http.StatusUnavailableForLegalReasons {
+		t.Errorf("redirect of a disabled link answered %d, want 451", w.Code)
+	}
+
+	if w := s.do(t, http.MethodPost, "/api/v1/links/"+code+"/enable", s.mintKey(t, bob), ""); w.Code != http.StatusForbidden {
+		t.Errorf("enabling with a user key answered %d, want 403", w.Code)
+	}
+	if w := s.do(t, http.MethodPost, "/api/v1/links/"+code+"/enable", admin, ""); w.Code != http.StatusOK {
+		t.Errorf("enabling with an admin key answered %d, want 200: %s", w.Code, w.Body)
+	}
+}
+
+func TestDisableBodyIsOptional(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.mintKey(t, nil, apikey.ScopeAdmin)
+	code := s.shorten(t, "", "https://example.com/shared")
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		want    int
+		status  int
+	}{
+		{"no body", "", false, http.StatusOK, http.StatusGone},
+		{"chunked without a body", "", true, http.StatusOK, http.StatusGone},
+		{"body", `{"status": 451}`, false, http.StatusOK, http.StatusUnavailableForLegalReasons},
+		{"chunked body", `{"status": 451}`, true, http.StatusOK, http.StatusUnavailableForLegalReasons},
+		{"chunked invalid body", `{"status":`, true, http.StatusBadRequest, http.StatusFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/links/"+code+"/disable", strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer "+admin)
+		if tt.chunked {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		s.handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: disable answered %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+
+		if w := s.do(t, http.MethodGet, "/"+code, "", ""); w.Code != tt.status {
+			t.Errorf("%s: redirect answered %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if w := s.do(t, http.MethodPost, "/api/v1/links/"+code+"/enable", admin, ""); w.Code != http.StatusOK {
+			t.Fatalf("enable answered %d: %s", w.Code, w.Body)
+		}
+	}
+}
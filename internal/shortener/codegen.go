@@ -0,0 +1,183 @@
+package shortener
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Code generator names, as used in the CODE_GENERATOR setting
+const (
+	GeneratorHash       = "hash"
+	GeneratorRandom     = "random"
+	GeneratorCounter    = "counter"
+	GeneratorObfuscated = "obfuscated"
+)
+
+// base62Alphabet is the alphabet of counter and obfuscated codes
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// feistelRounds is the number of rounds of the obfuscated code permutation
+const feistelRounds = 4
+
+// CodeGenerator produces candidate short codes for new links
+type CodeGenerator interface {
+	// Generate returns the candidate code of the given length for a retry attempt,
+	// starting at 0. seed identifies the link, usually by its normalized URL,
+	// and id is its row ID when UsesID is true, 0 otherwise
+	// An error means no code can be made, retrying won't help
+	Generate(seed string, id uint, length, attempt int) (string, error)
+
+	// UsesID reports whether codes derive from the row ID the store assigns,
+	// in which case links are saved first and get their code afterwards
+	UsesID() bool
+}
+
+// NewCodeGenerator creates the generator with the given name
+// The secret keys the obfuscated generator and is ignored by the others
+func NewCodeGenerator(name, secret string) (CodeGenerator, error) {
+	switch name {
+	case GeneratorHash:
+		return hashGenerator{}, nil
+	case GeneratorRandom:
+		return randomGenerator{}, nil
+	case GeneratorCounter:
+		return counterGenerator{}, nil
+	case GeneratorObfuscated:
+		if secret == "" {
+			return nil, errors.New("the obfuscated code generator needs a secret")
+		}
+		return obfuscatedGenerator{key: []byte(secret)}, nil
+	default:
+		return nil, fmt.Errorf("unknown code generator %q, must be hash, random, counter or obfuscated", name)
+	}
+}
+
+// hashGenerator truncates the SHA-256 of the seed, so the same URL always
+// gets the same code
+type hashGenerator struct{}
+
+func (hashGenerator) Generate(seed string, _ uint, length, attempt int) (string, error) {
+	// Add attempt number to input for different hashes on collision
+	input := fmt.Sprintf("%s:%d", seed, attempt)
+
+	hash := sha256.Sum256([]byte(input))
+
+	encoded := base64.URLEncoding.EncodeToString(hash[:])
+
+	encoded = strings.TrimRight(encoded, "=")
+
+	if len(encoded) > length {
+		return encoded[:length], nil
+	}
+
+	return encoded, nil
+}
+
+func (hashGenerator) UsesID() bool { return false }
+
+// randomGenerator draws codes from a cryptographic random source, so they
+// can't be guessed from the URL or from other codes
+type randomGenerator struct{}
+
+func (randomGenerator) Generate(_ string, _ uint, length, _ int) (string, error) {
+	buf := make([]byte, base64.RawURLEncoding.DecodedLen(length)+1)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)[:length], nil
+}
+
+func (randomGenerator) UsesID() bool { return false }
+
+// counterGenerator encodes the row ID in base62, giving the shortest codes
+// that never collide with each other, but are trivially enumerable
+// Retries, only needed when an alias or a reserved word took the code, add
+// attempt<<40 to the ID to move far past any real one, so a retried code is
+// at least 7 characters long whatever the configured length
+type counterGenerator struct{}
+
+func (counterGenerator) Generate(_ string, id uint, length, attempt int) (string, error) {
+	return encodeBase62(uint64(id)+uint64(attempt)<<40, length), nil
+}
+
+func (counterGenerator) UsesID() bool { return true }
+
+// obfuscatedGenerator runs the row ID through a keyed Feistel permutation
+// before encoding it, so codes look random but still never collide with
+// each other
+type obfuscatedGenerator struct {
+	key []byte
+}
+
+func (g obfuscatedGenerator) Generate(_ string, id uint, length, attempt int) (string, error) {
+	// Permute over the largest even number of bits that fits in length
+	// base62 digits, growing the code once IDs outgrow it
+	bits := permutationBits(length)
+	for bits < 64 && uint64(id)>>bits != 0 {
+		length++
+		bits = permutationBits(length)
+	}
+
+	return encodeBase62(g.permute(uint64(id), bits, attempt), length), nil
+}
+
+func (obfuscatedGenerator) UsesID() bool { return true }
+
+// permute is a balanced Feistel network over bits bits
+// The attempt is mixed into the round keys, giving a different permutation per retry
+func (g obfuscatedGenerator) permute(value uint64, bits, attempt int) uint64 {
+	half := bits / 2
+	mask := uint64(1)<<half - 1
+	left, right := value>>half&mask, value&mask
+
+	for round := range feistelRounds {
+		left, right = right, left^(g.roundFunc(round, attempt, right)&mask)
+	}
+	return left<<half | right
+}
+
+// roundFunc is the keyed pseudo-random function of a Feistel round
+func (g obfuscatedGenerator) roundFunc(round, attempt int, value uint64) uint64 {
+	var input [24]byte
+	binary.BigEndian.PutUint64(input[0:], uint64(round))
+	binary.BigEndian.PutUint64(input[8:], uint64(attempt))
+	binary.BigEndian.PutUint64(input[16:], value)
+
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write(input[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// permutationBits returns the largest even number of bits whose values
+// all fit in length base62 digits, at most 64
+func permutationBits(length int) int {
+	bits := int(float64(length) * math.Log2(62))
+	if bits > 64 {
+		bits = 64
+	}
+	return bits &^ 1
+}
+
+// encodeBase62 encodes value in base62, left padded with zeros to length
+func encodeBase62(value uint64, length int) string {
+	var digits []byte
+	for value > 0 {
+		digits = append(digits, base62Alphabet[value%62])
+		value /= 62
+	}
+	for len(digits) < length {
+		digits = append(digits, base62Alphabet[0])
+	}
+
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
@@ -0,0 +1,90 @@
+package shortener
+
+import (
+	"math"
+	"testing"
+)
+
+func TestObfuscatedGeneratorNeverCollides(t *testing.T) {
+	g := obfuscatedGenerator{key: []byte("secret")}
+
+	ids := []uint{1 << 40, 1 << 62, math.MaxUint64}
+	for id := uint(1); id <= 20000; id++ {
+		ids = append(ids, id)
+	}
+
+	for _, length := range []int{4, 7, 12} {
+		for attempt := range 3 {
+			seen := make(map[string]uint)
+			for _, id := range ids {
+				code, err := g.Generate("", id, length, attempt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(code) < length {
+					t.Fatalf("Generate(%d, length %d) = %q, shorter than the length", id, length, code)
+				}
+				if other, ok := seen[code]; ok {
+					t.Fatalf("IDs %d and %d both got code %q at length %d, attempt %d", other, id, code, length, attempt)
+				}
+				seen[code] = id
+			}
+		}
+	}
+}
+
+func TestObfuscatedGeneratorGrowsPastItsLength(t *testing.T) {
+	g := obfuscatedGenerator{key: []byte("secret")}
+
+	// 4 base62 digits hold 22 bits, larger IDs need longer codes
+	tests := []struct {
+		id   uint
+		want int
+	}{
+		{1<<22 - 1, 4},
+		{1 << 22, 5},
+		{math.MaxUint64, 11},
+	}
+	for _, tt := range tests {
+		if code, err := g.Generate("", tt.id, 4, 0); err != nil || len(code) != tt.want {
+			t.Errorf("Generate(%d, length 4) = %q, %v, want %d characters", tt.id, code, err, tt.want)
+		}
+	}
+}
+
+func TestObfuscatedGeneratorDependsOnTheKey(t *testing.T) {
+	code, _ := obfuscatedGenerator{key: []byte("secret")}.Generate("", 42, 7, 0)
+	other, _ := obfuscatedGenerator{key: []byte("other")}.Generate("", 42, 7, 0)
+	if code == other {
+		t.Errorf("both keys gave ID 42 the code %q", code)
+	}
+	if plain, _ := (counterGenerator{}).Generate("", 42, 7, 0); code == plain {
+		t.Errorf("obfuscated code %q is the plain counter code", code)
+	}
+}
+
+func TestCounterGeneratorLengths(t *testing.T) {
+	g := counterGenerator{}
+
+	tests := []struct {
+		id      uint
+		length  int
+		attempt int
+		want    string
+	}{
+		{1, 4, 0, "0001"},
+		{61, 4, 0, "000z"},
+		{62, 4, 0, "0010"},
+		{14776336, 4, 0, "10000"},
+		{1, 7, 0, "0000001"},
+		// Retries skip past every real ID, at least 7 characters at any length
+		{1, 4, 1, "JMAIjoX"},
+		{1, 7, 1, "JMAIjoX"},
+		{1, 12, 1, "00000JMAIjoX"},
+	}
+	for _, tt := range tests {
+		if got, err := g.Generate("", tt.id, tt.length, tt.attempt); err != nil || got != tt.want {
+			t.Errorf("Generate(%d, length %d, attempt %d) = %q, %v, want %q", tt.id, tt.length, tt.attempt, got, err, tt.want)
+		}
+	}
+}
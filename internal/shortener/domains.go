@@ -0,0 +1,216 @@
+package shortener
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/normalize"
+)
+
+// DomainPolicy decides which destination hosts may be shortened, from allow
+// and deny rules kept in a file that can be reloaded while the server runs
+//
+// The file holds one rule per line, "allow <pattern>" or "deny <pattern>",
+// with blank lines and lines starting with # ignored. A pattern is either
+//
+//	example.com     the host itself
+//	*.example.com   any subdomain of example.com, but not example.com
+//	.example.com    example.com and any of its subdomains
+//
+// Internationalized names may be written in Unicode or in punycode.
+// Deny rules win over allow rules. When there is at least one allow rule,
+// hosts that match none of them are rejected too
+type DomainPolicy struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   *domainRules
+	modTime time.Time
+}
+
+// domainRules is one parsed version of the rules file
+type domainRules struct {
+	allow []domainRule
+	deny  []domainRule
+}
+
+// domainRule is a single line of the rules file
+type domainRule struct {
+	text    string
+	line    int
+	pattern string
+}
+
+// LoadDomainPolicy reads the rules file at path
+func LoadDomainPolicy(path string) (*DomainPolicy, error) {
+	p := &DomainPolicy{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload reads the rules file again
+// On error the rules in use are kept
+func (p *DomainPolicy) Reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to read domain rules: %w", err)
+	}
+
+	rules, err := parseDomainRules(p.path)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.rules = rules
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+
+	log.Printf("Loaded %d allow and %d deny domain rules from %s", len(rules.allow), len(rules.deny), p.path)
+	return nil
+}
+
+// Watch reloads the rules whenever the file's modification time changes,
+// checking every interval until ctx is done
+func (p *DomainPolicy) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// A broken file is only reported once, not on every tick
+	p.mu.RLock()
+	seen := p.modTime
+	p.mu.RUnlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(p.path)
+			if err != nil || info.ModTime().Equal(seen) {
+				continue
+			}
+			seen = info.ModTime()
+
+			if err := p.Reload(); err != nil {
+				log.Printf("Keeping previous domain rules: %v", err)
+			}
+		}
+	}
+}
+
+// Check returns an error naming the rule that rejects host, if any
+func (p *DomainPolicy) Check(host string) error {
+	if p == nil {
+		return nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	p.mu.RLock()
+	rules := p.rules
+	p.mu.RUnlock()
+
+	for _, rule := range rules.deny {
+		if rule.matches(host) {
+			return newError(CodeBlockedDestination,
+				fmt.Sprintf("destination %q is denied by rule %q (line %d)", host, rule.text, rule.line))
+		}
+	}
+
+	if len(rules.allow) == 0 {
+		return nil
+	}
+	for _, rule := range rules.allow {
+		if rule.matches(host) {
+			return nil
+		}
+	}
+	return newError(CodeBlockedDestination, fmt.Sprintf("destination %q matches no allow rule", host))
+}
+
+// matches reports whether host is covered by the rule's pattern
+func (r domainRule) matches(host string) bool {
+	switch {
+	case strings.HasPrefix(r.pattern, "*."):
+		return strings.HasSuffix(host, r.pattern[1:])
+	case strings.HasPrefix(r.pattern, "."):
+		return host == r.pattern[1:] || strings.HasSuffix(host, r.pattern)
+	default:
+		return host == r.pattern
+	}
+}
+
+// parseDomainRules reads a rules file
+func parseDomainRules(path string) (*domainRules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read domain rules: %w", err)
+	}
+	defer file.Close()
+
+	rules := &domainRules{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"allow <pattern>\" or \"deny <pattern>\"", path, line)
+		}
+
+		pattern, err := parseDomainPattern(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %q", path, line, fields[1])
+		}
+
+		rule := domainRule{text: text, line: line, pattern: pattern}
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			rules.allow = append(rules.allow, rule)
+		case "deny":
+			rules.deny = append(rules.deny, rule)
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown action %q, must be allow or deny", path, line, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read domain rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// parseDomainPattern lowercases a pattern and converts its host to punycode,
+// the form destination hosts are checked in
+func parseDomainPattern(text string) (string, error) {
+	pattern := strings.TrimSuffix(strings.ToLower(text), ".")
+
+	prefix := ""
+	for _, p := range []string{"*.", "."} {
+		if strings.HasPrefix(pattern, p) {
+			prefix, pattern = p, pattern[len(p):]
+			break
+		}
+	}
+	if pattern == "" || strings.Contains(pattern, "*") {
+		return "", fmt.Errorf("invalid pattern %q", text)
+	}
+
+	host, err := normalize.ASCIIHost(pattern)
+	if err != nil {
+		return "", err
+	}
+	return prefix + host, nil
+}
@@ -0,0 +1,142 @@
+package shortener
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeDomainRules writes a rules file and loads it
+func writeDomainRules(t *testing.T, rules string) (*DomainPolicy, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "domains.rules")
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadDomainPolicy(path)
+}
+
+func TestDomainPolicyMatchesInternationalizedPatterns(t *testing.T) {
+	policy, err := writeDomainRules(t, `
+deny bücher.example
+deny *.MÜNCHEN.example
+deny .xn--caf-dma.example
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hosts reach Check in punycode, as validateURL converts them
+	tests := []struct {
+		host    string
+		blocked bool
+	}{
+		{"xn--bcher-kva.example", true},
+		{"shop.xn--bcher-kva.example", false},
+		{"www.xn--mnchen-3ya.example", true},
+		{"xn--mnchen-3ya.example", false},
+		{"xn--caf-dma.example", true},
+		{"menu.xn--caf-dma.example", true},
+		{"buecher.example", false},
+	}
+	for _, tt := range tests {
+		if blocked := policy.Check(tt.host) != nil; blocked != tt.blocked {
+			t.Errorf("Check(%q) blocked = %v, want %v", tt.host, blocked, tt.blocked)
+		}
+	}
+}
+
+func TestDomainPolicyRejectsInvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"*", "*.", ".", "a.*.example", "xn--ls8h-.example", "bad_host.example"} {
+		if _, err := writeDomainRules(t, "deny "+pattern+"\n"); err == nil {
+			t.Errorf("pattern %q was accepted, want an error", pattern)
+		}
+	}
+}
+
+func TestDomainPolicyReload(t *testing.T) {
+	policy, err := writeDomainRules(t, "deny old.example\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(policy.path, []byte("deny new.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Reload(); err != nil {
+		t.Fatalf("Reload = %v", err)
+	}
+	if policy.Check("old.example") != nil || policy.Check("new.example") == nil {
+		t.Error("Reload didn't replace the old rules with the new ones")
+	}
+
+	// A broken or missing file keeps the rules in use
+	if err := os.WriteFile(policy.path, []byte("deny *\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Reload(); err == nil {
+		t.Error("Reload of a broken file succeeded")
+	}
+	if err := os.Remove(policy.path); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Reload(); err == nil {
+		t.Error("Reload of a missing file succeeded")
+	}
+	if policy.Check("new.example") == nil {
+		t.Error("failed reloads dropped the previous rules")
+	}
+}
+
+func TestDomainPolicyWatch(t *testing.T) {
+	policy, err := writeDomainRules(t, "deny old.example\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go policy.Watch(ctx, 5*time.Millisecond)
+
+	// rewrite replaces the file and moves its modification time forward,
+	// since file systems may not notice two writes within a tick
+	mtime := time.Now()
+	rewrite := func(rules string) {
+		t.Helper()
+		mtime = mtime.Add(time.Minute)
+		if err := os.WriteFile(policy.path, []byte(rules), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(policy.path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); !done(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting until %s", what)
+			}
+		}
+	}
+
+	rewrite("deny new.example\n")
+	waitFor("the new rules apply", func() bool {
+		return policy.Check("new.example") != nil && policy.Check("old.example") == nil
+	})
+
+	// Give the watcher a few ticks to notice the broken file
+	rewrite("deny *\n")
+	time.Sleep(25 * time.Millisecond)
+	if policy.Check("new.example") == nil || policy.Check("old.example") != nil {
+		t.Error("a broken file replaced the previous rules")
+	}
+
+	rewrite("deny old.example\n")
+	waitFor("the fixed file applies", func() bool {
+		return policy.Check("old.example") != nil
+	})
+}
@@ -0,0 +1,132 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+// UpdateDestination points a link at a new URL on behalf of the caller,
+// recording the change in the link's history
+// The URL is checked like a new one, and pointing a link at its current
+// destination changes nothing
+func (s *Service) UpdateDestination(shortCode, rawURL string, caller Caller) (*models.URL, error) {
+	urlModel, err := s.findEditable(shortCode, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	// Links to our own short links would only add a redirect, or a loop
+	rawURL, err = s.resolveSelfLink(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanURL := s.normalizer.StripTracking(rawURL)
+	if s.stripTrackingFromOriginal {
+		rawURL = cleanURL
+	}
+
+	return s.retarget(urlModel, rawURL, cleanURL, caller, nil)
+}
+
+// RestoreRevision points a link back at the destination it had after the
+// revision with the given number, 0 for the destination it was created with
+// Restoring is recorded as a revision of its own
+func (s *Service) RestoreRevision(shortCode string, number int, caller Caller) (*models.URL, error) {
+	urlModel, err := s.findEditable(shortCode, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.store.ListRevisions(urlModel.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+
+	destination, ok := destinationAt(revisions, number)
+	if !ok {
+		return nil, newError(CodeNotFound, fmt.Sprintf("revision %d not found", number))
+	}
+
+	return s.retarget(urlModel, destination, s.normalizer.StripTracking(destination), caller, &number)
+}
+
+// ListRevisions returns a link and its revisions, newest first
+// Only the owner of a link and admins may read its history
+func (s *Service) ListRevisions(shortCode string, caller Caller) (*models.URL, []models.LinkRevision, error) {
+	urlModel, err := s.findManageable(shortCode, caller)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revisions, err := s.store.ListRevisions(urlModel.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	return urlModel, revisions, nil
+}
+
+// findEditable looks up a link the caller may edit
+// Anonymous links have nobody to answer for a change, so they never change
+func (s *Service) findEditable(shortCode string, caller Caller) (*models.URL, error) {
+	urlModel, err := s.findManageable(shortCode, caller)
+	if err != nil {
+		return nil, err
+	}
+	if urlModel.OwnerID == nil {
+		return nil, newError(CodeForbidden, "only links that belong to an account can be edited")
+	}
+
+	return urlModel, nil
+}
+
+// retarget checks a destination against the URL policies and saves it,
+// cleanURL being the destination without its tracking parameters
+// The link stops being reused for duplicates, it no longer matches the URL
+// it was shortened for
+func (s *Service) retarget(urlModel *models.URL, rawURL, cleanURL string, caller Caller, restoredFrom *int) (*models.URL, error) {
+	if err := s.validateURL(rawURL); err != nil {
+		return nil, err
+	}
+	if rawURL == urlModel.OriginalURL {
+		return urlModel, nil
+	}
+
+	normalizedURL := s.normalizeURL(cleanURL)
+	revision := &models.LinkRevision{
+		LinkID:       urlModel.ID,
+		PreviousURL:  urlModel.OriginalURL,
+		NewURL:       rawURL,
+		RestoredFrom: restoredFrom,
+	}
+	// Admin keys that act for nobody leave the editor unknown
+	if caller.UserID != 0 {
+		revision.EditorID = &caller.UserID
+	}
+	if err := s.store.UpdateDestination(revision, normalizedURL); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return nil, newError(CodeEditConflict, "the link was changed in the meantime, reload it and try again")
+		}
+		return nil, fmt.Errorf("failed to update link: %w", err)
+	}
+
+	urlModel.OriginalURL, urlModel.NormalizedURL, urlModel.DedupKey = rawURL, normalizedURL, nil
+	return urlModel, nil
+}
+
+// destinationAt returns the destination a link had after the revision with
+// the given number, revision 0 being the destination it was created with
+func destinationAt(revisions []models.LinkRevision, number int) (string, bool) {
+	for _, revision := range revisions {
+		switch {
+		case revision.Number == number:
+			return revision.NewURL, true
+		case number == 0 && revision.Number == 1:
+			return revision.PreviousURL, true
+		}
+	}
+	return "", false
+}
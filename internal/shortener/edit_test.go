@@ -0,0 +1,187 @@
+package shortener
+
+import "testing"
+
+func TestUpdateDestinationRecordsRevisions(t *testing.T) {
+	s, _ := newTestService(t, Options{})
+	owner := Caller{UserID: 1}
+
+	link, _, err := s.ShortenURL("https://example.com/v1", ShortenOptions{OwnerID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, destination := range []string{"https://example.com/v2", "https://example.com/v3"} {
+		updated, err := s.UpdateDestination(link.ShortCode, destination, owner)
+		if err != nil || updated.OriginalURL != destination {
+			t.Fatalf("UpdateDestination(%s) = %+v, %v", destination, updated, err)
+		}
+	}
+
+	// Pointing a link at its current destination isn't a change
+	if _, err := s.UpdateDestination(link.ShortCode, "https://example.com/v3", owner); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := s.RestoreRevision(link.ShortCode, 0, owner)
+	if err != nil || restored.OriginalURL != "https://example.com/v1" {
+		t.Fatalf("RestoreRevision(0) = %+v, %v, want the original destination", restored, err)
+	}
+	if got, _ := s.GetOriginalURL(link.ShortCode); got != "https://example.com/v1" {
+		t.Errorf("link redirects to %q after the restore", got)
+	}
+
+	_, revisions, err := s.ListRevisions(link.ShortCode, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		number       int
+		previous     string
+		next         string
+		restoredFrom int
+	}{
+		{3, "https://example.com/v3", "https://example.com/v1", 0},
+		{2, "https://example.com/v2", "https://example.com/v3", -1},
+		{1, "https://example.com/v1", "https://example.com/v2", -1},
+	}
+	if len(revisions) != len(want) {
+		t.Fatalf("ListRevisions = %+v, want %d revisions", revisions, len(want))
+	}
+	for i, w := range want {
+		r := revisions[i]
+		restoredFrom := -1
+		if r.RestoredFrom != nil {
+			restoredFrom = *r.RestoredFrom
+		}
+		if r.Number != w.number || r.PreviousURL != w.previous || r.NewURL != w.next ||
+			restoredFrom != w.restoredFrom || r.EditorID == nil || *r.EditorID != 1 {
+			t.Errorf("revision %d = %+v, want %+v edited by user 1", i, r, w)
+		}
+	}
+}
+
+func TestRestoreUnknownRevision(t *testing.T) {
+	s, _ := newTestService(t, Options{})
+	owner := Caller{UserID: 1}
+
+	link, _, err := s.ShortenURL("https://example.com/v1", ShortenOptions{OwnerID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A link that was never edited has no revision 0 to go back to either
+	for _, number := range []int{0, 1} {
+		if _, err := s.RestoreRevision(link.ShortCode, number, owner); ErrorCode(err) != CodeNotFound {
+			t.Errorf("RestoreRevision(%d) of an unedited link = %v, want %s", number, err, CodeNotFound)
+		}
+	}
+
+	if _, err := s.UpdateDestination(link.ShortCode, "https://example.com/v2", owner); err != nil {
+		t.Fatal(err)
+	}
+	for _, number := range []int{-1, 2} {
+		if _, err := s.RestoreRevision(link.ShortCode, number, owner); ErrorCode(err) != CodeNotFound {
+			t.Errorf("RestoreRevision(%d) = %v, want %s", number, err, CodeNotFound)
+		}
+	}
+}
+
+func TestEditPermissions(t *testing.T) {
+	s, _ := newTestService(t, Options{})
+
+	owned, _, err := s.ShortenURL("https://example.com/owned", ShortenOptions{OwnerID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous, _, err := s.ShortenURL("https://example.com/anonymous", ShortenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		shortCode string
+		caller    Caller
+		want      string
+	}{
+		{"owner", owned.ShortCode, Caller{UserID: 1}, ""},
+		{"another user", owned.ShortCode, Caller{UserID: 2}, CodeForbidden},
+		{"admin", owned.ShortCode, Caller{Admin: true}, ""},
+		{"anonymous link", anonymous.ShortCode, Caller{Admin: true}, CodeForbidden},
+		{"unknown link", "zzzz999", Caller{Admin: true}, CodeNotFound},
+	}
+	for i, tt := range tests {
+		destination := "https://example.com/edited/" + string(rune('a'+i))
+		if _, err := s.UpdateDestination(tt.shortCode, destination, tt.caller); ErrorCode(err) != tt.want {
+			t.Errorf("%s: UpdateDestination = %v, want code %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, _, err := s.ListRevisions(owned.ShortCode, Caller{UserID: 2}); ErrorCode(err) != CodeForbidden {
+		t.Errorf("ListRevisions by another user = %v, want %s", err, CodeForbidden)
+	}
+}
+
+func TestUpdateDestinationChecksPolicies(t *testing.T) {
+	network, err := NewNetworkPolicy(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestService(t, Options{Network: network, SelfDomains: []string{"sho.rt"}})
+	owner := Caller{UserID: 1}
+
+	link, _, err := s.ShortenURL("https://example.com/v1", ShortenOptions{OwnerID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		destination string
+		want        string
+	}{
+		{"http://127.0.0.1/admin", CodeBlockedDestination},
+		{"http://169.254.169.254/latest/meta-data", CodeBlockedDestination},
+		{"https://sho.rt/" + link.ShortCode, CodeSelfLink},
+		{"ftp://example.com/file", CodeInvalidURL},
+	}
+	for _, tt := range tests {
+		if _, err := s.UpdateDestination(link.ShortCode, tt.destination, owner); ErrorCode(err) != tt.want {
+			t.Errorf("UpdateDestination(%s) = %v, want %s", tt.destination, err, tt.want)
+		}
+	}
+
+	if got, _ := s.GetOriginalURL(link.ShortCode); got != "https://example.com/v1" {
+		t.Errorf("rejected edits changed the destination to %q", got)
+	}
+	if _, revisions, _ := s.ListRevisions(link.ShortCode, owner); len(revisions) != 0 {
+		t.Errorf("rejected edits left revisions %+v", revisions)
+	}
+}
+
+func TestUpdateDestinationStopsDeduplication(t *testing.T) {
+	s, links := newTestService(t, Options{})
+	owner := Caller{UserID: 1}
+
+	link, _, err := s.ShortenURL("https://example.com/v1", ShortenOptions{OwnerID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateDestination(link.ShortCode, "https://example.com/v2", owner); err != nil {
+		t.Fatal(err)
+	}
+
+	// The dedup key is cleared rather than recomputed: the owner chose the
+	// new destination for this code, it wasn't shortened for it
+	stored, err := links.FindByShortCode(link.ShortCode)
+	if err != nil || stored.DedupKey != nil {
+		t.Fatalf("edited link = %+v, %v, want no dedup key", stored, err)
+	}
+
+	for _, destination := range []string{"https://example.com/v1", "https://example.com/v2"} {
+		other, created, err := s.ShortenURL(destination, ShortenOptions{OwnerID: 1})
+		if err != nil || !created || other.ID == link.ID {
+			t.Errorf("shortening %s = %+v, %v, created %v, want a new link", destination, other, err, created)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package shortener
+
+import "errors"
+
+// Error codes returned to API clients so they don't have to parse messages
+const (
+	CodeInvalidURL         = "invalid_url"
+	CodeBlockedDestination = "destination_blocked"
+	CodeSelfLink           = "self_link"
+	CodeInvalidShortCode   = "invalid_short_code"
+	CodeNotFound           = "not_found"
+	CodeForbidden          = "forbidden"
+	CodeInvalidAlias       = "invalid_alias"
+	CodeAliasTaken         = "alias_taken"
+	CodeAliasReserved      = "alias_reserved"
+	CodeInvalidExpiry      = "invalid_expiry"
+	CodeExpired            = "link_expired"
+	CodeInvalidRedirect    = "invalid_redirect_status"
+	CodeEditConflict       = "edit_conflict"
+	CodeInvalidDisable     = "invalid_disable"
+)
+
+// Error is a request error caused by the caller rather than by the service
+// Code is stable and machine readable, Message is meant for humans
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// newError creates a new service error with the given code and message
+func newError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// ErrorCode returns the code of a service error, or an empty string
+// if err was not caused by the caller
+func ErrorCode(err error) string {
+	var svcErr *Error
+	if errors.As(err, &svcErr) {
+		return svcErr.Code
+	}
+	return ""
+}
@@ -0,0 +1,251 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lookupTimeout bounds the DNS lookup of a destination host
+const lookupTimeout = 2 * time.Second
+
+// internalPrefixes are the special purpose ranges not covered by the
+// netip.Addr predicates, such as carrier-grade NAT, reserved space and the
+// deprecated IPv6 site-local range
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("fec0::/10"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// Prefixes of IPv6 addresses that embed an IPv4 address
+var (
+	nat64Prefix     = netip.MustParsePrefix("64:ff9b::/96")
+	v4CompatPrefix  = netip.MustParsePrefix("::/96")
+	sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+)
+
+// metadataHostnames are the names cloud providers give their metadata services
+var metadataHostnames = map[string]bool{
+	"metadata":                   true,
+	"metadata.google.internal":   true,
+	"instance-data":              true,
+	"instance-data.ec2.internal": true,
+}
+
+// NetworkPolicy rejects destinations on loopback, private, link-local and
+// other internal networks, so that short links can't point at our own
+// infrastructure or a cloud metadata service
+type NetworkPolicy struct {
+	allowedHosts    map[string]bool
+	allowedPrefixes []netip.Prefix
+
+	// resolve makes the policy look up host names and check their addresses
+	resolve bool
+	lookup  func(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// NewNetworkPolicy creates a policy that lets the allowed entries through
+// Each entry is a host name, an IP address or a CIDR range
+// With resolve set, host names are looked up and checked too
+func NewNetworkPolicy(allow []string, resolve bool) (*NetworkPolicy, error) {
+	p := &NetworkPolicy{
+		allowedHosts: make(map[string]bool),
+		resolve:      resolve,
+		lookup:       net.DefaultResolver.LookupNetIP,
+	}
+	for _, entry := range allow {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			p.allowedPrefixes = append(p.allowedPrefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			p.allowedPrefixes = append(p.allowedPrefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		if strings.ContainsAny(entry, "/ ") {
+			return nil, fmt.Errorf("invalid allowed destination %q", entry)
+		}
+		p.allowedHosts[strings.TrimSuffix(entry, ".")] = true
+	}
+	return p, nil
+}
+
+// Check returns an error when host is, or resolves to, an internal address
+// Lookups give up after lookupTimeout
+// Host names that fail to resolve are let through: the check is about where
+// a host points, not whether it exists, and links are followed by browsers
+func (p *NetworkPolicy) Check(host string) error {
+	if p == nil {
+		return nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if p.allowedHosts[host] {
+		return nil
+	}
+
+	addr, isIP, err := parseHostIP(host)
+	if err != nil {
+		return newError(CodeInvalidURL, "URL host is not a valid IP address")
+	}
+	if isIP {
+		return p.checkAddr(host, addr)
+	}
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || metadataHostnames[host] {
+		return blockedDestinationError(host)
+	}
+
+	if !p.resolve {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	addrs, err := p.lookup(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := p.checkAddr(host, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAddr rejects internal addresses that aren't explicitly allowed
+func (p *NetworkPolicy) checkAddr(host string, addr netip.Addr) error {
+	addr = addr.WithZone("").Unmap()
+	for _, prefix := range p.allowedPrefixes {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+
+	if isInternalAddr(addr) {
+		return blockedDestinationError(host)
+	}
+
+	// Translated and tunnelled IPv6 addresses reach the IPv4 address inside them
+	if embedded, ok := embeddedIPv4(addr); ok {
+		return p.checkAddr(host, embedded)
+	}
+	return nil
+}
+
+// isInternalAddr reports whether addr can't be reached from the public internet
+func isInternalAddr(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedIPv4 extracts the IPv4 address of NAT64, IPv4-compatible and 6to4 addresses
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	if !addr.Is6() {
+		return netip.Addr{}, false
+	}
+
+	b := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr), v4CompatPrefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFourPrefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	default:
+		return netip.Addr{}, false
+	}
+}
+
+// parseHostIP parses a URL host the way browsers do, so that IPv4 addresses
+// written as "2130706433", "0x7f.1" or "0177.0.0.1" are recognised
+// isIP is false for host names, err is set for hosts that look like an
+// address but aren't a valid one
+func parseHostIP(host string) (addr netip.Addr, isIP bool, err error) {
+	if strings.Contains(host, ":") {
+		addr, err = netip.ParseAddr(host)
+		return addr, true, err
+	}
+
+	parts := strings.Split(host, ".")
+	if _, ok := parseIPv4Part(parts[len(parts)-1]); !ok {
+		// Only hosts ending in a number are IPv4 addresses
+		return netip.Addr{}, false, nil
+	}
+	if len(parts) > 4 {
+		return netip.Addr{}, true, fmt.Errorf("too many parts in IPv4 address %q", host)
+	}
+
+	var value uint64
+	for i, part := range parts {
+		n, ok := parseIPv4Part(part)
+		if !ok {
+			return netip.Addr{}, true, fmt.Errorf("invalid IPv4 address %q", host)
+		}
+
+		// The last part fills every byte the others left
+		if i == len(parts)-1 {
+			if n >= 1<<(8*(5-len(parts))) {
+				return netip.Addr{}, true, fmt.Errorf("invalid IPv4 address %q", host)
+			}
+			value |= n
+			break
+		}
+		if n > 255 {
+			return netip.Addr{}, true, fmt.Errorf("invalid IPv4 address %q", host)
+		}
+		value |= n << (8 * (3 - i))
+	}
+
+	return netip.AddrFrom4([4]byte{byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}), true, nil
+}
+
+// parseIPv4Part parses one part of an IPv4 address in decimal, octal with
+// a leading 0 or hexadecimal with a leading 0x
+func parseIPv4Part(part string) (uint64, bool) {
+	base := 10
+	switch {
+	case part == "":
+		return 0, false
+	case strings.HasPrefix(part, "0x"):
+		part, base = part[2:], 16
+		if part == "" {
+			return 0, true
+		}
+	case len(part) > 1 && part[0] == '0':
+		part, base = part[1:], 8
+	}
+
+	n, err := strconv.ParseUint(part, base, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// blockedDestinationError reports a destination on an internal network
+func blockedDestinationError(host string) error {
+	return newError(CodeBlockedDestination, fmt.Sprintf("destination %q is on a private or internal network", host))
+}
@@ -0,0 +1,183 @@
+package shortener
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParseHostIP(t *testing.T) {
+	tests := []struct {
+		host    string
+		want    string
+		isIP    bool
+		wantErr bool
+	}{
+		{host: "example.com"},
+		{host: "metadata.google.internal"},
+		{host: "1.example"},
+		{host: "127.0.0.1", want: "127.0.0.1", isIP: true},
+		{host: "127.1", want: "127.0.0.1", isIP: true},
+		{host: "127.0.1", want: "127.0.0.1", isIP: true},
+		{host: "2130706433", want: "127.0.0.1", isIP: true},
+		{host: "0x7f000001", want: "127.0.0.1", isIP: true},
+		{host: "0x7f.1", want: "127.0.0.1", isIP: true},
+		{host: "0177.0.0.1", want: "127.0.0.1", isIP: true},
+		{host: "0x7f.0.0.0x1", want: "127.0.0.1", isIP: true},
+		{host: "0xa9.0xfe.0xa9.0xfe", want: "169.254.169.254", isIP: true},
+		{host: "0x", want: "0.0.0.0", isIP: true},
+		{host: "::1", want: "::1", isIP: true},
+		{host: "::ffff:127.0.0.1", want: "::ffff:127.0.0.1", isIP: true},
+		{host: "fe80::1%eth0", want: "fe80::1%eth0", isIP: true},
+		{host: "1.2.3.4.5", isIP: true, wantErr: true},
+		{host: "256.0.0.1", isIP: true, wantErr: true},
+		{host: "1.2.3.256", isIP: true, wantErr: true},
+		{host: "1.2.65536", isIP: true, wantErr: true},
+		{host: "4294967296", isIP: true, wantErr: true},
+		{host: "1.09.0.1", isIP: true, wantErr: true},
+		{host: "::g", isIP: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			addr, isIP, err := parseHostIP(tt.host)
+			if isIP != tt.isIP {
+				t.Errorf("isIP = %v, want %v", isIP, tt.isIP)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.want != "" && addr != netip.MustParseAddr(tt.want) {
+				t.Errorf("addr = %v, want %v", addr, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyCheck(t *testing.T) {
+	policy, err := NewNetworkPolicy([]string{"intranet.example", "10.1.0.0/16", "192.168.1.10"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		// Loopback in every spelling browsers accept
+		{"127.0.0.1", CodeBlockedDestination},
+		{"127.1", CodeBlockedDestination},
+		{"2130706433", CodeBlockedDestination},
+		{"0x7f000001", CodeBlockedDestination},
+		{"0177.0.0.1", CodeBlockedDestination},
+		{"::1", CodeBlockedDestination},
+		{"::ffff:127.0.0.1", CodeBlockedDestination},
+		{"localhost", CodeBlockedDestination},
+		{"localhost.", CodeBlockedDestination},
+		{"api.localhost", CodeBlockedDestination},
+
+		// Private, link-local and other internal ranges
+		{"10.0.0.1", CodeBlockedDestination},
+		{"172.16.0.1", CodeBlockedDestination},
+		{"192.168.0.1", CodeBlockedDestination},
+		{"169.254.169.254", CodeBlockedDestination},
+		{"100.64.0.1", CodeBlockedDestination},
+		{"0.0.0.0", CodeBlockedDestination},
+		{"0", CodeBlockedDestination},
+		{"224.0.0.1", CodeBlockedDestination},
+		{"fe80::1", CodeBlockedDestination},
+		{"fe80::1%eth0", CodeBlockedDestination},
+		{"fc00::1", CodeBlockedDestination},
+		{"fec0::1", CodeBlockedDestination},
+		{"::", CodeBlockedDestination},
+
+		// IPv6 addresses embedding an internal IPv4 address
+		{"64:ff9b::a9fe:a9fe", CodeBlockedDestination},
+		{"::127.0.0.1", CodeBlockedDestination},
+		{"2002:7f00:1::", CodeBlockedDestination},
+
+		// Cloud metadata services
+		{"metadata", CodeBlockedDestination},
+		{"metadata.google.internal", CodeBlockedDestination},
+		{"metadata.google.internal.", CodeBlockedDestination},
+		{"METADATA.GOOGLE.INTERNAL", CodeBlockedDestination},
+		{"instance-data.ec2.internal", CodeBlockedDestination},
+
+		// Hosts that look like an address but aren't one
+		{"1.2.3.4.5", CodeInvalidURL},
+		{"256.0.0.1", CodeInvalidURL},
+
+		// Public destinations and explicitly allowed ones
+		{"example.com", ""},
+		{"8.8.8.8", ""},
+		{"2606:4700::1111", ""},
+		{"64:ff9b::808:808", ""},
+		{"intranet.example", ""},
+		{"intranet.example.", ""},
+		{"10.1.2.3", ""},
+		{"::ffff:10.1.2.3", ""},
+		{"192.168.1.10", ""},
+		{"192.168.1.11", CodeBlockedDestination},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := ErrorCode(policy.Check(tt.host)); got != tt.want {
+				t.Errorf("Check(%q) code = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyResolvesHosts(t *testing.T) {
+	policy, err := NewNetworkPolicy([]string{"10.1.0.0/16"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := map[string][]netip.Addr{
+		"public.example":  {netip.MustParseAddr("93.184.215.14")},
+		"private.example": {netip.MustParseAddr("93.184.215.14"), netip.MustParseAddr("10.0.0.1")},
+		"allowed.example": {netip.MustParseAddr("10.1.2.3")},
+	}
+	policy.lookup = func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > lookupTimeout {
+			t.Errorf("lookup of %s has deadline %v, want one within %s", host, deadline, lookupTimeout)
+		}
+		if host == "slow.example" {
+			return nil, context.DeadlineExceeded
+		}
+		if addrs, ok := records[host]; ok {
+			return addrs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"public.example", ""},
+		{"private.example", CodeBlockedDestination},
+		{"allowed.example", ""},
+		{"unknown.example", ""},
+		{"slow.example", ""},
+		// IP addresses and known internal names are never looked up
+		{"localhost", CodeBlockedDestination},
+		{"10.0.0.1", CodeBlockedDestination},
+	}
+	for _, tt := range tests {
+		if got := ErrorCode(policy.Check(tt.host)); got != tt.want {
+			t.Errorf("Check(%q) code = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestNewNetworkPolicyRejectsInvalidEntries(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "intranet example"} {
+		if _, err := NewNetworkPolicy([]string{entry}, false); err == nil {
+			t.Errorf("NewNetworkPolicy(%q) succeeded, want an error", entry)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package shortener
+
+import (
+	"strings"
+	"sync"
+)
+
+// ReservedWords is a set of words that can never be used as short codes,
+// usually because the router serves its own pages under them
+// Words are compared case-insensitively
+type ReservedWords struct {
+	mu    sync.RWMutex
+	words map[string]struct{}
+}
+
+// NewReservedWords creates a set holding the given words
+func NewReservedWords(words ...string) *ReservedWords {
+	r := &ReservedWords{words: make(map[string]struct{})}
+	r.Add(words...)
+	return r
+}
+
+// Add reserves more words, empty words are ignored
+func (r *ReservedWords) Add(words ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			r.words[word] = struct{}{}
+		}
+	}
+}
+
+// Contains reports whether the code is reserved
+func (r *ReservedWords) Contains(code string) bool {
+	if r == nil {
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.words[strings.ToLower(code)]
+	return ok
+}
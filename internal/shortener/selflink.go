@@ -0,0 +1,94 @@
+package shortener
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// maxSelfLinkHops bounds how many of our own short links are followed
+// when resolving a self link
+const maxSelfLinkHops = 5
+
+// resolveSelfLink handles destinations that are short links of this service
+// They are rejected, or with resolveSelfLinks replaced by the URL they lead
+// to, following chains of short links and refusing loops
+// Any other URL is returned unchanged
+func (s *Service) resolveSelfLink(rawURL string) (string, error) {
+	visited := make(map[string]bool)
+
+	for hop := 0; ; hop++ {
+		parsedURL, err := url.Parse(rawURL)
+		if err != nil || !s.isSelfHost(parsedURL) {
+			return rawURL, nil
+		}
+
+		if !s.resolveSelfLinks {
+			return "", newError(CodeSelfLink, "links to this URL shortener can't be shortened again")
+		}
+
+		shortCode := strings.TrimPrefix(parsedURL.Path, "/")
+		if !s.isValidShortCode(shortCode) {
+			return "", newError(CodeSelfLink, fmt.Sprintf("%q is not a short link of this URL shortener", rawURL))
+		}
+
+		if visited[shortCode] {
+			return "", newError(CodeSelfLink, fmt.Sprintf("short link %q is part of a redirect loop", shortCode))
+		}
+		if hop == maxSelfLinkHops {
+			return "", newError(CodeSelfLink,
+				fmt.Sprintf("short link %q redirects through more than %d short links", shortCode, maxSelfLinkHops))
+		}
+		visited[shortCode] = true
+
+		urlModel, err := s.GetURL(shortCode)
+		if err != nil {
+			if ErrorCode(err) != "" {
+				return "", newError(CodeSelfLink, fmt.Sprintf("short link %q can't be resolved: %v", shortCode, err))
+			}
+			return "", err
+		}
+		if urlModel.IsDisabled() {
+			return "", newError(CodeSelfLink, fmt.Sprintf("short link %q has been disabled", shortCode))
+		}
+		rawURL = urlModel.OriginalURL
+	}
+}
+
+// isSelfHost reports whether a URL points at one of the service's own domains
+// Domains configured without a port match the host on any port
+func (s *Service) isSelfHost(parsedURL *url.URL) bool {
+	host := strings.TrimSuffix(strings.ToLower(parsedURL.Hostname()), ".")
+	port := parsedURL.Port()
+	if port == "" {
+		port = defaultPort(parsedURL.Scheme)
+	}
+
+	for _, domain := range s.selfDomains {
+		domainHost, domainPort, err := net.SplitHostPort(domain)
+		if err != nil {
+			domainHost, domainPort = strings.Trim(domain, "[]"), ""
+		}
+
+		if host != strings.TrimSuffix(strings.ToLower(domainHost), ".") {
+			continue
+		}
+		if domainPort == "" || domainPort == port {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPort returns the port a scheme uses when the URL doesn't name one
+func defaultPort(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	default:
+		return ""
+	}
+}
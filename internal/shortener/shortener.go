@@ -1,134 +1,666 @@
 package shortener
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"iter"
+	"log"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/ItsDobiel/URLShortener/internal/database"
+	"github.com/ItsDobiel/URLShortener/internal/metrics"
 	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/normalize"
+	"github.com/ItsDobiel/URLShortener/internal/store"
 )
 
 const (
-	// maxCollisionRetries defines how many times to retry on hash collision
-	maxCollisionRetries = 5
+	// defaultCollisionRetries is how many codes are tried at each length
+	// when Options.CollisionRetries isn't set
+	defaultCollisionRetries = 5
+
+	// maxCodeLength is the longest valid short code
+	maxCodeLength = 20
+
+	// placeholderPrefix starts the temporary codes of links waiting for an
+	// ID based code, it is not a valid short code character
+	placeholderPrefix = "~"
+
+	// placeholderLength matches the size of the short_code column
+	placeholderLength = 20
+
+	// maxURLLength matches the size of the URL columns of links and revisions
+	maxURLLength = 2048
+
+	// maxDisabledReasonLength matches the size of the disabled_reason column
+	maxDisabledReasonLength = 255
 )
 
 // Service handles URL shortening operations
 type Service struct {
+	store      store.LinkStore
 	codeLength int
+	generator  CodeGenerator
+
+	// Codes grow up to maxLength once retries at a length run out
+	maxLength int
+	retries   int
+
+	reserved   *ReservedWords
+	network    *NetworkPolicy
+	domains    *DomainPolicy
+	normalizer *normalize.Normalizer
+
+	stripTrackingFromOriginal bool
+
+	selfDomains      []string
+	resolveSelfLinks bool
+}
+
+// Options configures a Service
+type Options struct {
+	// CodeLength is the length of generated short codes
+	CodeLength int
+
+	// MaxCodeLength is the length codes may grow to when too many of the
+	// shorter ones are taken, 0 to never grow past CodeLength
+	MaxCodeLength int
+
+	// CollisionRetries is how many codes are tried at each length, 0 for the default
+	CollisionRetries int
+
+	// Generator produces the short codes, nil for the hash generator
+	Generator CodeGenerator
+
+	// Reserved holds the words that can never be used as short codes
+	Reserved *ReservedWords
+
+	// Network rejects destinations on internal networks, nil allows every destination
+	Network *NetworkPolicy
+
+	// Domains holds the allow and deny rules for destination hosts, nil allows every host
+	Domains *DomainPolicy
+
+	// Normalizer canonicalizes URLs for duplicate detection, nil applies every rule
+	Normalizer *normalize.Normalizer
+
+	// StripTrackingFromOriginal removes tracking parameters from the stored
+	// destination too, not only from the form used for duplicate detection
+	StripTrackingFromOriginal bool
+
+	// SelfDomains are the hosts short links are served from
+	// Links pointing back at them are rejected, or resolved when ResolveSelfLinks is set
+	SelfDomains      []string
+	ResolveSelfLinks bool
 }
 
-// NewService creates a new shortener service
-func NewService(codeLength int) *Service {
+// NewService creates a new shortener service backed by the given store
+func NewService(linkStore store.LinkStore, opts Options) *Service {
+	if opts.Generator == nil {
+		opts.Generator = hashGenerator{}
+	}
+	if opts.MaxCodeLength < opts.CodeLength {
+		opts.MaxCodeLength = opts.CodeLength
+	}
+	if opts.MaxCodeLength > maxCodeLength {
+		opts.MaxCodeLength = maxCodeLength
+	}
+	if opts.CollisionRetries <= 0 {
+		opts.CollisionRetries = defaultCollisionRetries
+	}
+	if opts.Normalizer == nil {
+		rules, _ := normalize.ParseRules(normalize.AllRules)
+		opts.Normalizer = normalize.New(rules)
+	}
+
 	return &Service{
-		codeLength: codeLength,
+		store:      linkStore,
+		codeLength: opts.CodeLength,
+		generator:  opts.Generator,
+		maxLength:  opts.MaxCodeLength,
+		retries:    opts.CollisionRetries,
+		reserved:   opts.Reserved,
+		network:    opts.Network,
+		domains:    opts.Domains,
+		normalizer: opts.Normalizer,
+
+		stripTrackingFromOriginal: opts.StripTrackingFromOriginal,
+
+		selfDomains:      opts.SelfDomains,
+		resolveSelfLinks: opts.ResolveSelfLinks,
 	}
 }
 
+// ShortenOptions holds the optional, per-request settings for ShortenURL
+type ShortenOptions struct {
+	// Alias is a custom short code chosen by the user, empty to generate one
+	Alias string
+
+	// ExpiresAt is the moment the link stops working, nil for no expiry
+	ExpiresAt *time.Time
+
+	// TTL sets the expiry relative to the time of creation instead
+	TTL time.Duration
+
+	// RedirectStatus is the status code used to redirect, 0 for the default
+	RedirectStatus int
+
+	// KeepTrackingParams leaves tracking parameters such as utm_source alone
+	KeepTrackingParams bool
+
+	// OwnerID is the user creating the link, 0 for anonymous links
+	// Duplicates are only detected among the links of the same owner
+	OwnerID uint
+}
+
+// Caller is who a link is read or changed on behalf of
+type Caller struct {
+	// UserID is the user acting, 0 for anonymous callers
+	UserID uint
+
+	// Admin callers may manage every link, anonymous ones included
+	Admin bool
+}
+
+// shared reports whether the link may be handed to everyone shortening the
+// same URL, which is only the case for generated links with default settings
+func (o ShortenOptions) shared() bool {
+	return o.Alias == "" && o.ExpiresAt == nil && o.TTL == 0 && o.RedirectStatus == 0
+}
+
+// IsRedirectStatus reports whether code is a status code links may redirect with
+func IsRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsDisabledStatus reports whether code is a status code disabled links may answer with
+func IsDisabledStatus(code int) bool {
+	return code == http.StatusGone || code == http.StatusUnavailableForLegalReasons
+}
+
 // ShortenURL creates a short code for the given URL
-// If the URL has been shortened before, it returns the existing short code
-// Returns the short code and any error encountered
-func (s *Service) ShortenURL(rawURL string) (string, error) {
+// If the URL has been shortened before, it returns the existing mapping
+// unless a custom alias or an expiry was requested
+// Returns the URL mapping, whether it was newly created and any error encountered
+func (s *Service) ShortenURL(rawURL string, opts ShortenOptions) (*models.URL, bool, error) {
+	urlModel, created, err := s.shorten(rawURL, opts)
+
+	outcome := metrics.OutcomeDeduplicated
+	switch {
+	case err != nil && ErrorCode(err) != "":
+		outcome = metrics.OutcomeInvalid
+	case err != nil:
+		outcome = metrics.OutcomeError
+	case created:
+		outcome = metrics.OutcomeCreated
+	}
+	metrics.ShortenRequests.WithLabelValues(outcome).Inc()
+
+	return urlModel, created, err
+}
+
+// shorten does the work of ShortenURL
+func (s *Service) shorten(rawURL string, opts ShortenOptions) (*models.URL, bool, error) {
+	// Links to our own short links would only add a redirect, or a loop
+	rawURL, err := s.resolveSelfLink(rawURL)
+	if err != nil {
+		return nil, false, err
+	}
+
 	// Validate URL format
 	if err := s.validateURL(rawURL); err != nil {
-		return "", err
+		return nil, false, err
+	}
+
+	expiresAt, err := expiryFor(opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if opts.RedirectStatus != 0 && !IsRedirectStatus(opts.RedirectStatus) {
+		return nil, false, newError(CodeInvalidRedirect, "redirect status must be 301, 302, 307 or 308")
+	}
+
+	// Tracking parameters differ from one share to the next and would
+	// defeat duplicate detection
+	cleanURL := rawURL
+	if !opts.KeepTrackingParams {
+		cleanURL = s.normalizer.StripTracking(rawURL)
+		if s.stripTrackingFromOriginal {
+			rawURL = cleanURL
+		}
 	}
 
 	// Normalize the URL for consistent handling
-	normalizedURL := s.normalizeURL(rawURL)
+	normalizedURL := s.normalizeURL(cleanURL)
+
+	urlModel := &models.URL{
+		OriginalURL:    rawURL,
+		NormalizedURL:  normalizedURL,
+		ExpiresAt:      expiresAt,
+		RedirectStatus: opts.RedirectStatus,
+	}
+	if opts.OwnerID != 0 {
+		urlModel.OwnerID = &opts.OwnerID
+	}
+
+	if opts.Alias != "" {
+		urlModel.ShortCode = opts.Alias
+		return s.createAlias(urlModel)
+	}
+
+	// Shared links hash to the same code every time, private ones get a
+	// random seed so that they don't keep colliding with each other
+	seed := dedupKey(opts.OwnerID, normalizedURL)
+	if opts.shared() {
+		existingURL, err := s.store.FindByDedupKey(seed)
+		if err == nil && existingURL != nil {
+			return existingURL, false, nil
+		}
+		urlModel.DedupKey = &seed
+	} else {
+		seed += ":" + rand.Text()
+	}
 
-	existingURL, err := database.FindByNormalizedURL(normalizedURL)
-	if err == nil && existingURL != nil {
-		return existingURL.ShortCode, nil
+	if s.generator.UsesID() {
+		return s.createWithIDCode(urlModel, seed)
 	}
 
-	shortCode, err := s.generateUniqueShortCode(normalizedURL)
+	urlModel.ShortCode, err = s.generateUniqueShortCode(seed)
 	if err != nil {
-		return "", err
+		return nil, false, err
 	}
 
-	urlModel := &models.URL{
-		ShortCode:     shortCode,
-		OriginalURL:   rawURL,
-		NormalizedURL: normalizedURL,
+	return s.save(urlModel)
+}
+
+// save stores a new link, or returns the existing shared link when someone
+// else shortened the same URL in the meantime
+func (s *Service) save(urlModel *models.URL) (*models.URL, bool, error) {
+	if err := s.store.Create(urlModel); err != nil {
+		if errors.Is(err, store.ErrConflict) && urlModel.DedupKey != nil {
+			if existingURL, err := s.store.FindByDedupKey(*urlModel.DedupKey); err == nil {
+				return existingURL, false, nil
+			}
+		}
+		return nil, false, fmt.Errorf("failed to save URL: %w", err)
+	}
+
+	return urlModel, true, nil
+}
+
+// createWithIDCode stores a link whose code derives from its row ID
+// The link is inserted under a placeholder code, which is never a valid
+// short code, then gets its real code together with its dedup key, so that
+// nobody is handed the placeholder as a shared link
+func (s *Service) createWithIDCode(urlModel *models.URL, seed string) (*models.URL, bool, error) {
+	dedupKey := urlModel.DedupKey
+	placeholder := placeholderPrefix + rand.Text()[:placeholderLength-len(placeholderPrefix)]
+	urlModel.ShortCode, urlModel.DedupKey = placeholder, nil
+
+	if err := s.store.Create(urlModel); err != nil {
+		return nil, false, fmt.Errorf("failed to save URL: %w", err)
+	}
+
+	for shortCode, err := range s.candidateCodes(seed, urlModel.ID) {
+		if err != nil {
+			s.discardPlaceholder(placeholder)
+			return nil, false, err
+		}
+
+		err = s.store.AssignShortCode(urlModel.ID, shortCode, dedupKey)
+		if err == nil {
+			urlModel.ShortCode, urlModel.DedupKey = shortCode, dedupKey
+			return urlModel, true, nil
+		}
+		if !errors.Is(err, store.ErrConflict) {
+			s.discardPlaceholder(placeholder)
+			return nil, false, fmt.Errorf("failed to save URL: %w", err)
+		}
+
+		// The conflict is either on the code or on the dedup key
+		if dedupKey != nil {
+			if existingURL, err := s.store.FindByDedupKey(*dedupKey); err == nil {
+				s.discardPlaceholder(placeholder)
+				return existingURL, false, nil
+			}
+		}
+		metrics.CollisionRetries.Inc()
+	}
+
+	s.discardPlaceholder(placeholder)
+	return nil, false, s.exhaustedError()
+}
+
+// discardPlaceholder removes a link that never got its real code
+func (s *Service) discardPlaceholder(placeholder string) {
+	if err := s.store.DeleteByShortCode(placeholder); err != nil {
+		log.Printf("Failed to remove placeholder link %s: %v", placeholder, err)
+	}
+}
+
+// createAlias stores the URL under the short code chosen by the user
+// Asking again for the same alias and settings returns the existing mapping
+func (s *Service) createAlias(urlModel *models.URL) (*models.URL, bool, error) {
+	alias := urlModel.ShortCode
+	if !s.isValidShortCode(alias) {
+		return nil, false, newError(CodeInvalidAlias,
+			"alias must be 4 to 20 characters long and contain only letters, digits, '-' or '_'")
+	}
+
+	if s.reserved.Contains(alias) {
+		return nil, false, newError(CodeAliasReserved, fmt.Sprintf("alias %q is reserved", alias))
+	}
+
+	existingURL, err := s.store.FindByShortCode(alias)
+	if err == nil {
+		// Deleted links keep their alias, so that it never points somewhere new
+		if existingURL.IsDeleted() {
+			return nil, false, aliasTakenError(alias)
+		}
+		if existingURL.NormalizedURL == urlModel.NormalizedURL && existingURL.DedupKey == nil &&
+			sameOwner(existingURL.OwnerID, urlModel.OwnerID) &&
+			existingURL.ExpiresAt == nil && urlModel.ExpiresAt == nil &&
+			existingURL.RedirectStatus == urlModel.RedirectStatus {
+			return existingURL, false, nil
+		}
+		return nil, false, aliasTakenError(alias)
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, false, fmt.Errorf("failed to check alias availability: %w", err)
+	}
+
+	if err := s.store.Create(urlModel); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return nil, false, aliasTakenError(alias)
+		}
+		return nil, false, fmt.Errorf("failed to save URL: %w", err)
 	}
 
-	if err := database.Create(urlModel); err != nil {
-		return "", fmt.Errorf("failed to save URL: %w", err)
+	return urlModel, true, nil
+}
+
+// dedupKey scopes duplicate detection to the owner of a link, anonymous
+// links share the bare normalized URL
+// Normalized URLs never contain spaces, so owned keys can't clash with them
+func dedupKey(ownerID uint, normalizedURL string) string {
+	if ownerID == 0 {
+		return normalizedURL
 	}
+	return "user:" + strconv.FormatUint(uint64(ownerID), 10) + " " + normalizedURL
+}
 
-	return shortCode, nil
+// sameOwner reports whether two links belong to the same user, or are both anonymous
+func sameOwner(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// expiryFor turns the expiry options into an absolute time
+// It returns nil when the link should never expire
+func expiryFor(opts ShortenOptions) (*time.Time, error) {
+	switch {
+	case opts.ExpiresAt != nil && opts.TTL != 0:
+		return nil, newError(CodeInvalidExpiry, "set either an expiry time or a TTL, not both")
+	case opts.TTL < 0:
+		return nil, newError(CodeInvalidExpiry, "TTL must be positive")
+	case opts.TTL > 0:
+		expiresAt := time.Now().Add(opts.TTL).UTC()
+		return &expiresAt, nil
+	case opts.ExpiresAt != nil:
+		if !opts.ExpiresAt.After(time.Now()) {
+			return nil, newError(CodeInvalidExpiry, "expiry time must be in the future")
+		}
+		expiresAt := opts.ExpiresAt.UTC()
+		return &expiresAt, nil
+	default:
+		return nil, nil
+	}
 }
 
 // GetOriginalURL retrieves the original URL for a given short code
 func (s *Service) GetOriginalURL(shortCode string) (string, error) {
+	urlModel, err := s.GetURL(shortCode)
+	if err != nil {
+		return "", err
+	}
+
+	return urlModel.OriginalURL, nil
+}
+
+// GetURL retrieves the full URL mapping for a given short code
+func (s *Service) GetURL(shortCode string) (*models.URL, error) {
 	if !s.isValidShortCode(shortCode) {
-		return "", fmt.Errorf("invalid short code format")
+		return nil, newError(CodeInvalidShortCode, "invalid short code format")
 	}
 
-	urlModel, err := database.FindByShortCode(shortCode)
+	urlModel, err := s.findURL(shortCode)
 	if err != nil {
-		return "", fmt.Errorf("short code not found")
+		return nil, err
 	}
 
-	return urlModel.OriginalURL, nil
+	if urlModel.IsExpired(time.Now()) {
+		return nil, newError(CodeExpired, "short code has expired")
+	}
+
+	return urlModel, nil
 }
 
-// validateURL checks if the URL is valid and uses supported protocol
-func (s *Service) validateURL(rawURL string) error {
-	if rawURL == "" {
-		return fmt.Errorf("URL cannot be empty")
+// GetLinkForStats retrieves a link whose click statistics the caller may read
+// Expired links are included, their clicks stay readable until they are swept
+func (s *Service) GetLinkForStats(shortCode string, caller Caller) (*models.URL, error) {
+	if !s.isValidShortCode(shortCode) {
+		return nil, newError(CodeInvalidShortCode, "invalid short code format")
 	}
 
-	parsedURL, err := url.Parse(rawURL)
+	urlModel, err := s.findURL(shortCode)
 	if err != nil {
-		return fmt.Errorf("invalid URL format")
+		return nil, err
+	}
+	if err := checkReader(urlModel, caller); err != nil {
+		return nil, err
 	}
 
-	scheme := strings.ToLower(parsedURL.Scheme)
-	if scheme != "http" && scheme != "https" {
-		return fmt.Errorf("only HTTP and HTTPS protocols are supported")
+	return urlModel, nil
+}
+
+// DeleteURL deletes the URL mapping for a given short code on behalf of the caller
+// Owned links can only be deleted by their owner and anonymous links by
+// admins, expired links can still be deleted
+// The short code stays taken until the deleted link is purged
+func (s *Service) DeleteURL(shortCode string, caller Caller) error {
+	if _, err := s.findManageable(shortCode, caller); err != nil {
+		return err
 	}
 
-	if parsedURL.Host == "" {
-		return fmt.Errorf("URL must have a valid host")
+	if err := s.store.DeleteByShortCode(shortCode); err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
 	}
 
 	return nil
 }
 
-// normalizeURL converts a URL to a canonical form for duplicate detection
-// This handles trailing slashes, case-insensitive protocols/domains.
-func (s *Service) normalizeURL(rawURL string) string {
+// DisableLink stops a link from redirecting on behalf of the caller
+// The link answers status, 410 or 451 and 0 for the default, with the reason
+func (s *Service) DisableLink(shortCode string, status int, reason string, caller Caller) (*models.URL, error) {
+	reason = strings.TrimSpace(reason)
+	if status != 0 && !IsDisabledStatus(status) {
+		return nil, newError(CodeInvalidDisable, "disabled status must be 410 or 451")
+	}
+	if len(reason) > maxDisabledReasonLength {
+		return nil, newError(CodeInvalidDisable,
+			fmt.Sprintf("reason must be at most %d characters long", maxDisabledReasonLength))
+	}
+
+	urlModel, err := s.findManageable(shortCode, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.store.DisableByShortCode(shortCode, now, status, reason); err != nil {
+		return nil, fmt.Errorf("failed to disable link: %w", err)
+	}
+
+	urlModel.DisabledAt, urlModel.DisabledStatus, urlModel.DisabledReason = &now, status, reason
+	urlModel.DedupKey = nil
+	return urlModel, nil
+}
+
+// EnableLink lets a disabled link redirect again on behalf of the caller
+func (s *Service) EnableLink(shortCode string, caller Caller) (*models.URL, error) {
+	urlModel, err := s.findManageable(shortCode, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.EnableByShortCode(shortCode); err != nil {
+		return nil, fmt.Errorf("failed to enable link: %w", err)
+	}
+
+	urlModel.DisabledAt, urlModel.DisabledStatus, urlModel.DisabledReason = nil, 0, ""
+	return urlModel, nil
+}
+
+// findManageable looks up a link the caller may manage
+func (s *Service) findManageable(shortCode string, caller Caller) (*models.URL, error) {
+	if !s.isValidShortCode(shortCode) {
+		return nil, newError(CodeInvalidShortCode, "invalid short code format")
+	}
+
+	urlModel, err := s.findURL(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckOwner(urlModel, caller); err != nil {
+		return nil, err
+	}
+
+	return urlModel, nil
+}
+
+// CheckOwner returns an error unless the caller may manage a link: its owner
+// or an admin. Anonymous links belong to nobody and are shared by everyone
+// who shortened their URL, so only admins may manage them
+func CheckOwner(urlModel *models.URL, caller Caller) error {
+	switch {
+	case caller.Admin, urlModel.IsOwnedBy(caller.UserID):
+		return nil
+	case urlModel.OwnerID == nil:
+		return newError(CodeForbidden, "anonymous links can only be managed by an administrator")
+	default:
+		return newError(CodeForbidden, "this link belongs to another user")
+	}
+}
+
+// checkReader returns an error unless the caller may read the details of a
+// link, which anyone may do for anonymous links
+func checkReader(urlModel *models.URL, caller Caller) error {
+	if urlModel.OwnerID == nil {
+		return nil
+	}
+	return CheckOwner(urlModel, caller)
+}
+
+// ListLinks returns the links created by a user, newest first
+func (s *Service) ListLinks(userID uint) ([]models.URL, error) {
+	urls, err := s.store.ListByOwner(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+
+	// Links still waiting for an ID based code aren't ready to be shown
+	ready := urls[:0]
+	for _, url := range urls {
+		if !strings.HasPrefix(url.ShortCode, placeholderPrefix) {
+			ready = append(ready, url)
+		}
+	}
+	return ready, nil
+}
+
+// Ping checks that the backing store is ready to serve requests
+func (s *Service) Ping(ctx context.Context) error {
+	return s.store.Ping(ctx)
+}
+
+// findURL looks up a short code, whether or not it has expired or been disabled
+// Deleted links are reported as not found
+func (s *Service) findURL(shortCode string) (*models.URL, error) {
+	urlModel, err := s.store.FindByShortCode(shortCode)
+	if errors.Is(err, store.ErrNotFound) || err == nil && urlModel.IsDeleted() {
+		return nil, newError(CodeNotFound, "short code not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up short code: %w", err)
+	}
+
+	return urlModel, nil
+}
+
+// validateURL checks if the URL is valid and uses supported protocol
+func (s *Service) validateURL(rawURL string) error {
+	if rawURL == "" {
+		return newError(CodeInvalidURL, "URL cannot be empty")
+	}
+	if len(rawURL) > maxURLLength {
+		return newError(CodeInvalidURL, fmt.Sprintf("URL must be at most %d characters long", maxURLLength))
+	}
+
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
-		return rawURL
+		return newError(CodeInvalidURL, "invalid URL format")
 	}
 
-	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	scheme := strings.ToLower(parsedURL.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return newError(CodeInvalidURL, "only HTTP and HTTPS protocols are supported")
+	}
 
-	parsedURL.Host = strings.ToLower(parsedURL.Host)
+	if parsedURL.Host == "" {
+		return newError(CodeInvalidURL, "URL must have a valid host")
+	}
 
-	if len(parsedURL.Path) > 1 && strings.HasSuffix(parsedURL.Path, "/") {
-		parsedURL.Path = strings.TrimSuffix(parsedURL.Path, "/")
+	// Policies compare hosts in their ASCII form, whatever the URL used
+	host, err := normalize.ASCIIHost(parsedURL.Hostname())
+	if err != nil {
+		host = parsedURL.Hostname()
 	}
 
-	if parsedURL.Path == "" {
-		parsedURL.Path = "/"
+	if err := s.domains.Check(host); err != nil {
+		return err
 	}
 
-	return parsedURL.String()
+	return s.network.Check(host)
+}
+
+// normalizeURL converts a URL to a canonical form for duplicate detection
+func (s *Service) normalizeURL(rawURL string) string {
+	return s.normalizer.Normalize(rawURL)
 }
 
 // generateUniqueShortCode creates a short code that doesn't collide with existing ones
-func (s *Service) generateUniqueShortCode(normalizedURL string) (string, error) {
-	for attempt := 0; attempt < maxCollisionRetries; attempt++ {
-		shortCode := s.generateShortCode(normalizedURL, attempt)
+// The seed is usually the normalized URL so that the hash generator gives the same URL the same code
+func (s *Service) generateUniqueShortCode(seed string) (string, error) {
+	for shortCode, err := range s.candidateCodes(seed, 0) {
+		if err != nil {
+			return "", err
+		}
 
-		taken, err := database.IsShortCodeTaken(shortCode)
+		taken, err := s.store.IsShortCodeTaken(shortCode)
 		if err != nil {
 			return "", fmt.Errorf("failed to check short code availability: %w", err)
 		}
@@ -136,28 +668,52 @@ func (s *Service) generateUniqueShortCode(normalizedURL string) (string, error)
 		if !taken {
 			return shortCode, nil
 		}
+		metrics.CollisionRetries.Inc()
 	}
 
-	return "", fmt.Errorf("failed to generate unique short code after %d attempts", maxCollisionRetries)
+	return "", s.exhaustedError()
 }
 
-// generateShortCode creates a short code using SHA-256 hash
-// The attempt parameter allows generating different codes on collision
-func (s *Service) generateShortCode(normalizedURL string, attempt int) string {
-	// Add attempt number to input for different hashes on collision
-	input := fmt.Sprintf("%s:%d", normalizedURL, attempt)
-
-	hash := sha256.Sum256([]byte(input))
-
-	encoded := base64.URLEncoding.EncodeToString(hash[:])
-
-	encoded = strings.TrimRight(encoded, "=")
-
-	if len(encoded) > s.codeLength {
-		return encoded[:s.codeLength]
+// candidateCodes yields the codes to try for a new link, retries times at
+// the configured length, then retries times at each longer length up to
+// maxLength, so that a crowded code space makes codes longer instead of
+// failing
+// Reserved words are skipped and counted like any other collision
+// A generator error is yielded last and ends the sequence
+func (s *Service) candidateCodes(seed string, id uint) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for length := s.codeLength; length <= s.maxLength; length++ {
+			if length > s.codeLength {
+				metrics.CodeLengthEscalations.WithLabelValues(strconv.Itoa(length)).Inc()
+			}
+
+			for attempt := range s.retries {
+				shortCode, err := s.generator.Generate(seed, id, length, attempt)
+				if err != nil {
+					yield("", fmt.Errorf("failed to generate short code: %w", err))
+					return
+				}
+				if s.reserved.Contains(shortCode) {
+					metrics.CollisionRetries.Inc()
+					continue
+				}
+				if !yield(shortCode, nil) {
+					return
+				}
+			}
+		}
 	}
+}
+
+// exhaustedError reports that every candidate code was taken
+func (s *Service) exhaustedError() error {
+	return fmt.Errorf("failed to generate unique short code after %d attempts at lengths %d to %d",
+		s.retries*(s.maxLength-s.codeLength+1), s.codeLength, s.maxLength)
+}
 
-	return encoded
+// aliasTakenError reports that a custom alias is already in use
+func aliasTakenError(alias string) error {
+	return newError(CodeAliasTaken, fmt.Sprintf("alias %q is already taken", alias))
 }
 
 // isValidShortCode checks if a short code matches expected format
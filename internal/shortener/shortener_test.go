@@ -0,0 +1,314 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/normalize"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+// newTestService creates a service on an empty in-memory store
+func newTestService(t *testing.T, opts Options) (*Service, *store.MemoryStore) {
+	t.Helper()
+
+	if opts.CodeLength == 0 {
+		opts.CodeLength = 7
+	}
+	links := store.NewMemoryStore()
+	return NewService(links, opts), links
+}
+
+func TestShortenAndGet(t *testing.T) {
+	s, _ := newTestService(t, Options{})
+
+	link, created, err := s.ShortenURL("https://example.com/page", ShortenOptions{})
+	if err != nil || !created {
+		t.Fatalf("ShortenURL = %v, created %v", err, created)
+	}
+	if len(link.ShortCode) != 7 || link.OriginalURL != "https://example.com/page" {
+		t.Errorf("ShortenURL = %+v, want a 7 character code for the URL", link)
+	}
+
+	got, err := s.GetURL(link.ShortCode)
+	if err != nil || got.ID != link.ID {
+		t.Fatalf("GetURL(%q) = %+v, %v, want the new link", link.ShortCode, got, err)
+	}
+	if url, err := s.GetOriginalURL(link.ShortCode); err != nil || url != "https://example.com/page" {
+		t.Errorf("GetOriginalURL = %q, %v", url, err)
+	}
+
+	if _, err := s.GetURL("zzzz999"); ErrorCode(err) != CodeNotFound {
+		t.Errorf("GetURL of an unknown code = %v, want %s", err, CodeNotFound)
+	}
+	if _, err := s.GetURL("no"); ErrorCode(err) != CodeInvalidShortCode {
+		t.Errorf("GetURL of an invalid code = %v, want %s", err, CodeInvalidShortCode)
+	}
+}
+
+func TestShortenReusesDuplicates(t *testing.T) {
+	rules, err := normalize.ParseRules(normalize.AllRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules.TrackingParams = normalize.DefaultTrackingParams
+	s, _ := newTestService(t, Options{Normalizer: normalize.New(rules)})
+
+	first, _, err := s.ShortenURL("https://example.com/a?b=2&a=1", ShortenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		opts   ShortenOptions
+		reused bool
+	}{
+		{"same URL", "https://example.com/a?b=2&a=1", ShortenOptions{}, true},
+		{"same URL after normalization", "HTTPS://EXAMPLE.com:443/a/?a=1&b=2", ShortenOptions{}, true},
+		{"tracking parameters", "https://example.com/a?b=2&a=1&utm_source=mail", ShortenOptions{}, true},
+		{"another owner", "https://example.com/a?b=2&a=1", ShortenOptions{OwnerID: 1}, false},
+		{"custom redirect status", "https://example.com/a?b=2&a=1", ShortenOptions{RedirectStatus: 301}, false},
+		{"another URL", "https://example.com/b", ShortenOptions{}, false},
+	}
+	for _, tt := range tests {
+		link, created, err := s.ShortenURL(tt.url, tt.opts)
+		if err != nil {
+			t.Errorf("%s: ShortenURL = %v", tt.name, err)
+			continue
+		}
+		if reused := link.ID == first.ID; reused != tt.reused || created == tt.reused {
+			t.Errorf("%s: got link %d, created %v, want reused %v", tt.name, link.ID, created, tt.reused)
+		}
+	}
+}
+
+func TestShortenWithAlias(t *testing.T) {
+	s, _ := newTestService(t, Options{Reserved: NewReservedWords("admin")})
+
+	link, created, err := s.ShortenURL("https://example.com/a", ShortenOptions{Alias: "my-link"})
+	if err != nil || !created || link.ShortCode != "my-link" {
+		t.Fatalf("ShortenURL with an alias = %+v, %v, created %v", link, err, created)
+	}
+
+	// Asking again for the same alias and URL is not a conflict
+	again, created, err := s.ShortenURL("https://example.com/a", ShortenOptions{Alias: "my-link"})
+	if err != nil || created || again.ID != link.ID {
+		t.Errorf("repeated alias = %+v, %v, created %v, want the existing link", again, err, created)
+	}
+
+	tests := []struct {
+		name  string
+		url   string
+		alias string
+		want  string
+	}{
+		{"alias of another URL", "https://example.com/b", "my-link", CodeAliasTaken},
+		{"reserved word", "https://example.com/b", "Admin", CodeAliasReserved},
+		{"too short", "https://example.com/b", "abc", CodeInvalidAlias},
+		{"invalid characters", "https://example.com/b", "my link", CodeInvalidAlias},
+	}
+	for _, tt := range tests {
+		if _, _, err := s.ShortenURL(tt.url, ShortenOptions{Alias: tt.alias}); ErrorCode(err) != tt.want {
+			t.Errorf("%s: ShortenURL = %v, want code %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Aliases are never handed out as duplicates of their URL
+	generated, created, err := s.ShortenURL("https://example.com/a", ShortenOptions{})
+	if err != nil || !created || generated.ID == link.ID {
+		t.Errorf("shortening an aliased URL = %+v, %v, created %v, want a new link", generated, err, created)
+	}
+}
+
+func TestShortenWithIDCodesReplacesPlaceholder(t *testing.T) {
+	s, links := newTestService(t, Options{Generator: counterGenerator{}})
+
+	link, created, err := s.ShortenURL("https://example.com/a", ShortenOptions{OwnerID: 1})
+	if err != nil || !created {
+		t.Fatalf("ShortenURL = %v, created %v", err, created)
+	}
+	if link.ShortCode != "0000001" {
+		t.Errorf("short code = %q, want the encoded ID 0000001", link.ShortCode)
+	}
+
+	stored, err := links.FindByShortCode(link.ShortCode)
+	if err != nil || stored.DedupKey == nil {
+		t.Fatalf("stored link = %+v, %v, want it under its code with its dedup key", stored, err)
+	}
+
+	again, created, err := s.ShortenURL("https://example.com/a", ShortenOptions{OwnerID: 1})
+	if err != nil || created || again.ID != link.ID {
+		t.Errorf("duplicate = %+v, %v, created %v, want the existing link", again, err, created)
+	}
+
+	listed, err := s.ListLinks(1)
+	if err != nil || len(listed) != 1 || strings.HasPrefix(listed[0].ShortCode, placeholderPrefix) {
+		t.Errorf("ListLinks = %+v, %v, want the one link under its real code", listed, err)
+	}
+}
+
+func TestURLLengthLimit(t *testing.T) {
+	s, _ := newTestService(t, Options{})
+	base := "https://example.com/"
+	longest := base + strings.Repeat("a", maxURLLength-len(base))
+	tooLong := longest + "a"
+
+	if _, _, err := s.ShortenURL(longest, ShortenOptions{OwnerID: 1}); err != nil {
+		t.Fatalf("ShortenURL of a %d byte URL = %v", len(longest), err)
+	}
+	if _, _, err := s.ShortenURL(tooLong, ShortenOptions{}); ErrorCode(err) != CodeInvalidURL {
+		t.Errorf("ShortenURL of a %d byte URL = %v, want %s", len(tooLong), err, CodeInvalidURL)
+	}
+
+	link, _, err := s.ShortenURL("https://example.com/short", ShortenOptions{OwnerID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateDestination(link.ShortCode, tooLong, Caller{UserID: 1}); ErrorCode(err) != CodeInvalidURL {
+		t.Errorf("UpdateDestination to a %d byte URL = %v, want %s", len(tooLong), err, CodeInvalidURL)
+	}
+}
+
+// sequenceGenerator numbers its codes by attempt, zero padded to the length,
+// so that tests know every candidate in advance
+// With failAt set it fails once it reaches that length
+type sequenceGenerator struct {
+	usesID bool
+	failAt int
+}
+
+func (g sequenceGenerator) Generate(_ string, _ uint, length, attempt int) (string, error) {
+	if g.failAt != 0 && length >= g.failAt {
+		return "", errors.New("generator failed")
+	}
+	return fmt.Sprintf("%0*d", length, attempt), nil
+}
+
+func (g sequenceGenerator) UsesID() bool { return g.usesID }
+
+func TestCandidateCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		reserved []string
+		want     []string
+	}{
+		{
+			name: "retries at the configured length only",
+			opts: Options{CodeLength: 4, CollisionRetries: 3},
+			want: []string{"0000", "0001", "0002"},
+		},
+		{
+			name: "escalates up to the maximum length",
+			opts: Options{CodeLength: 4, MaxCodeLength: 6, CollisionRetries: 2},
+			want: []string{"0000", "0001", "00000", "00001", "000000", "000001"},
+		},
+		{
+			name:     "skips reserved words",
+			opts:     Options{CodeLength: 4, MaxCodeLength: 5, CollisionRetries: 2},
+			reserved: []string{"0001", "00000"},
+			want:     []string{"0000", "00001"},
+		},
+		{
+			name: "maximum length is capped",
+			opts: Options{CodeLength: 19, MaxCodeLength: 40, CollisionRetries: 1},
+			want: []string{"0000000000000000000", "00000000000000000000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Generator = sequenceGenerator{}
+			tt.opts.Reserved = NewReservedWords(tt.reserved...)
+			s, _ := newTestService(t, tt.opts)
+
+			var got []string
+			for code, err := range s.candidateCodes("seed", 0) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, code)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("candidateCodes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortenEscalatesPastCollisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		usesID   bool
+		taken    []string
+		reserved []string
+		want     string
+	}{
+		{name: "free code", want: "0000"},
+		{name: "one collision", taken: []string{"0000"}, want: "0001"},
+		{name: "length exhausted", taken: []string{"0000", "0001"}, want: "00000"},
+		{name: "reserved and taken", taken: []string{"0000"}, reserved: []string{"0001"}, want: "00000"},
+		{name: "every length exhausted", taken: []string{"0000", "0001", "00000", "00001"}},
+		{name: "ID codes, free code", usesID: true, want: "0000"},
+		{name: "ID codes, length exhausted", usesID: true, taken: []string{"0000", "0001"}, want: "00000"},
+		{name: "ID codes, every length exhausted", usesID: true, taken: []string{"0000", "0001", "00000", "00001"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, links := newTestService(t, Options{
+				CodeLength:       4,
+				MaxCodeLength:    5,
+				CollisionRetries: 2,
+				Generator:        sequenceGenerator{usesID: tt.usesID},
+				Reserved:         NewReservedWords(tt.reserved...),
+			})
+			for _, code := range tt.taken {
+				if err := links.Create(&models.URL{ShortCode: code, OriginalURL: "https://example.org/" + code}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			link, _, err := s.ShortenURL("https://example.com/", ShortenOptions{})
+			if tt.want == "" {
+				if err == nil || ErrorCode(err) != "" || !strings.Contains(err.Error(), "after 4 attempts at lengths 4 to 5") {
+					t.Fatalf("ShortenURL = %+v, %v, want the exhausted error", link, err)
+				}
+				return
+			}
+			if err != nil || link.ShortCode != tt.want {
+				t.Fatalf("ShortenURL = %+v, %v, want code %q", link, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortenReportsGeneratorErrors(t *testing.T) {
+	for _, usesID := range []bool{false, true} {
+		s, links := newTestService(t, Options{
+			CodeLength:       4,
+			MaxCodeLength:    5,
+			CollisionRetries: 2,
+			Generator:        sequenceGenerator{usesID: usesID, failAt: 5},
+		})
+		for _, code := range []string{"0000", "0001"} {
+			if err := links.Create(&models.URL{ShortCode: code, OriginalURL: "https://example.org/" + code}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		link, _, err := s.ShortenURL("https://example.com/", ShortenOptions{OwnerID: 1})
+		if err == nil || !strings.Contains(err.Error(), "generator failed") {
+			t.Errorf("uses ID %v: ShortenURL = %+v, %v, want the generator error", usesID, link, err)
+		}
+		if listed, _ := s.ListLinks(1); len(listed) != 0 {
+			t.Errorf("uses ID %v: a failed link was kept: %+v", usesID, listed)
+		}
+	}
+}
@@ -0,0 +1,557 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MemoryStore is a Store that keeps every mapping in memory
+// It is meant for tests and ephemeral deployments, all data is lost on exit
+type MemoryStore struct {
+	mu          sync.RWMutex
+	nextID      uint
+	byID        map[uint]*models.URL
+	byShortCode map[string]*models.URL
+	byDedupKey  map[string]*models.URL
+	archive     []models.ArchivedURL
+	clicks      []models.Click
+	apiKeys     []*models.APIKey
+	users       []*models.User
+	sessions    map[string]*models.Session
+	revisions   map[uint][]models.LinkRevision
+
+	nextSessionID  uint
+	nextRevisionID uint
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		nextID:      1,
+		byID:        make(map[uint]*models.URL),
+		byShortCode: make(map[string]*models.URL),
+		byDedupKey:  make(map[string]*models.URL),
+		sessions:    make(map[string]*models.Session),
+		revisions:   make(map[uint][]models.LinkRevision),
+	}
+}
+
+// FindByShortCode retrieves a URL by its short code
+func (m *MemoryStore) FindByShortCode(shortCode string) (*models.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	url, ok := m.byShortCode[shortCode]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *url
+	return &copied, nil
+}
+
+// FindByDedupKey retrieves the reusable URL with the given dedup key
+func (m *MemoryStore) FindByDedupKey(dedupKey string) (*models.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	url, ok := m.byDedupKey[dedupKey]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *url
+	return &copied, nil
+}
+
+// ListByOwner returns the links of a user, newest first
+func (m *MemoryStore) ListByOwner(ownerID uint) ([]models.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var urls []models.URL
+	for _, url := range m.byShortCode {
+		if url.IsOwnedBy(ownerID) && !url.IsDeleted() {
+			urls = append(urls, *url)
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID > urls[j].ID })
+	return urls, nil
+}
+
+// Create saves a new URL mapping and fills in its ID
+func (m *MemoryStore) Create(url *models.URL) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.byShortCode[url.ShortCode]; ok {
+		return ErrConflict
+	}
+	if url.DedupKey != nil {
+		if _, ok := m.byDedupKey[*url.DedupKey]; ok {
+			return ErrConflict
+		}
+	}
+
+	url.ID = m.nextID
+	m.nextID++
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = time.Now()
+	}
+
+	stored := *url
+	m.byID[stored.ID] = &stored
+	m.byShortCode[stored.ShortCode] = &stored
+	if stored.DedupKey != nil {
+		m.byDedupKey[*stored.DedupKey] = &stored
+	}
+	return nil
+}
+
+// AssignShortCode replaces the short code and dedup key of the URL with the given ID
+// Deleted links keep their code
+func (m *MemoryStore) AssignShortCode(id uint, shortCode string, dedupKey *string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	url, ok := m.byID[id]
+	if !ok || url.IsDeleted() {
+		return ErrNotFound
+	}
+
+	if other, ok := m.byShortCode[shortCode]; ok && other != url {
+		return ErrConflict
+	}
+	if dedupKey != nil {
+		if other, ok := m.byDedupKey[*dedupKey]; ok && other != url {
+			return ErrConflict
+		}
+	}
+
+	delete(m.byShortCode, url.ShortCode)
+	if url.DedupKey != nil {
+		delete(m.byDedupKey, *url.DedupKey)
+	}
+	url.ShortCode, url.DedupKey = shortCode, dedupKey
+	m.byShortCode[shortCode] = url
+	if dedupKey != nil {
+		m.byDedupKey[*dedupKey] = url
+	}
+	return nil
+}
+
+// UpdateDestination points a link at a new destination and saves the revision
+func (m *MemoryStore) UpdateDestination(revision *models.LinkRevision, normalizedURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	url, ok := m.byID[revision.LinkID]
+	if !ok || url.IsDeleted() || url.OriginalURL != revision.PreviousURL {
+		return ErrConflict
+	}
+
+	url.OriginalURL, url.NormalizedURL = revision.NewURL, normalizedURL
+	m.clearDedupKey(url)
+
+	m.nextRevisionID++
+	revision.ID = m.nextRevisionID
+	revision.Number = len(m.revisions[url.ID]) + 1
+	if revision.CreatedAt.IsZero() {
+		revision.CreatedAt = time.Now()
+	}
+	stored := *revision
+	stored.Link, stored.Editor = nil, nil
+	m.revisions[url.ID] = append(m.revisions[url.ID], stored)
+	return nil
+}
+
+// ListRevisions returns the revisions of a link with their editors, newest first
+func (m *MemoryStore) ListRevisions(linkID uint) ([]models.LinkRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored := m.revisions[linkID]
+	revisions := make([]models.LinkRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revision := stored[i]
+		if revision.EditorID != nil && *revision.EditorID != 0 && int(*revision.EditorID) <= len(m.users) {
+			editor := *m.users[*revision.EditorID-1]
+			revision.Editor = &editor
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// DisableByShortCode disables the link with the given short code
+func (m *MemoryStore) DisableByShortCode(shortCode string, at time.Time, status int, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	url, ok := m.byShortCode[shortCode]
+	if !ok || url.IsDeleted() {
+		return ErrNotFound
+	}
+	url.DisabledAt, url.DisabledStatus, url.DisabledReason = &at, status, reason
+	m.clearDedupKey(url)
+	return nil
+}
+
+// EnableByShortCode lets a disabled link redirect again
+func (m *MemoryStore) EnableByShortCode(shortCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	url, ok := m.byShortCode[shortCode]
+	if !ok || url.IsDeleted() {
+		return ErrNotFound
+	}
+	url.DisabledAt, url.DisabledStatus, url.DisabledReason = nil, 0, ""
+	return nil
+}
+
+// DeleteByShortCode marks the URL mapping with the given short code deleted
+func (m *MemoryStore) DeleteByShortCode(shortCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	url, ok := m.byShortCode[shortCode]
+	if !ok || url.IsDeleted() {
+		return nil
+	}
+	url.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	m.clearDedupKey(url)
+	return nil
+}
+
+// PurgeDeleted turns the links deleted at or before the given time into tombstones
+func (m *MemoryStore) PurgeDeleted(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for _, url := range m.byShortCode {
+		if url.IsDeleted() && !url.IsPurged() && !url.DeletedAt.Time.After(before) {
+			m.purge(url)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// clearDedupKey stops a stored URL from being reused for duplicates
+// The caller must hold the lock
+func (m *MemoryStore) clearDedupKey(url *models.URL) {
+	if url.DedupKey != nil {
+		delete(m.byDedupKey, *url.DedupKey)
+		url.DedupKey = nil
+	}
+}
+
+// purge drops the destination and revisions of a deleted URL, keeping it
+// indexed under its short code as a tombstone
+// The caller must hold the lock
+func (m *MemoryStore) purge(url *models.URL) {
+	m.clearDedupKey(url)
+	url.OriginalURL, url.NormalizedURL = "", ""
+	delete(m.revisions, url.ID)
+}
+
+// IsShortCodeTaken checks if a short code already exists
+func (m *MemoryStore) IsShortCodeTaken(shortCode string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.byShortCode[shortCode]
+	return ok, nil
+}
+
+// DeleteExpired deletes every link that has expired at the given time and
+// turns it into a tombstone
+func (m *MemoryStore) DeleteExpired(now time.Time, archive bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var removed int64
+	for _, url := range m.byShortCode {
+		if !url.IsExpired(now) || url.IsPurged() {
+			continue
+		}
+
+		if archive {
+			m.archive = append(m.archive, url.Archive(now))
+		}
+		if !url.IsDeleted() {
+			url.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+		}
+		m.purge(url)
+		removed++
+	}
+	return removed, nil
+}
+
+// Archived returns the links archived so far, oldest first
+func (m *MemoryStore) Archived() []models.ArchivedURL {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.archive)
+}
+
+// RecordClicks saves a batch of click events
+func (m *MemoryStore) RecordClicks(clicks []models.Click) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clicks = append(m.clicks, clicks...)
+	return nil
+}
+
+// ClickStats aggregates the clicks of a short link
+func (m *MemoryStore) ClickStats(shortCode string, since time.Time, limit int) (*models.ClickStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := &models.ClickStats{ShortCode: shortCode, ClicksPerDay: []models.DayCount{}}
+	sinceDay := since.UTC().Format(time.DateOnly)
+	perDay := make(map[string]int64)
+	referrers := make(map[string]int64)
+	userAgents := make(map[string]int64)
+
+	for _, click := range m.clicks {
+		if click.ShortCode != shortCode {
+			continue
+		}
+		stats.TotalClicks++
+		if click.Day >= sinceDay {
+			perDay[click.Day]++
+		}
+		referrers[click.Referrer]++
+		userAgents[click.UAFamily]++
+	}
+
+	for day, clicks := range perDay {
+		stats.ClicksPerDay = append(stats.ClicksPerDay, models.DayCount{Day: day, Clicks: clicks})
+	}
+	sort.Slice(stats.ClicksPerDay, func(i, j int) bool {
+		return stats.ClicksPerDay[i].Day < stats.ClicksPerDay[j].Day
+	})
+
+	stats.TopReferrers = topValues(referrers, limit)
+	stats.TopUserAgents = topValues(userAgents, limit)
+	return stats, nil
+}
+
+// topValues returns the limit most frequent values, ties broken alphabetically
+func topValues(counts map[string]int64, limit int) []models.ValueCount {
+	values := make([]models.ValueCount, 0, len(counts))
+	for value, clicks := range counts {
+		values = append(values, models.ValueCount{Value: value, Clicks: clicks})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Clicks != values[j].Clicks {
+			return values[i].Clicks > values[j].Clicks
+		}
+		return values[i].Value < values[j].Value
+	})
+
+	if len(values) > limit {
+		values = values[:limit]
+	}
+	return values
+}
+
+// CreateAPIKey saves a new API key and fills in its ID
+func (m *MemoryStore) CreateAPIKey(key *models.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.apiKeys {
+		if existing.Prefix == key.Prefix || existing.KeyHash == key.KeyHash {
+			return ErrConflict
+		}
+	}
+
+	key.ID = uint(len(m.apiKeys) + 1)
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	stored := *key
+	m.apiKeys = append(m.apiKeys, &stored)
+	return nil
+}
+
+// FindAPIKeyByHash retrieves the API key with the given hash
+func (m *MemoryStore) FindAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == keyHash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListAPIKeys returns every API key, oldest first
+func (m *MemoryStore) ListAPIKeys() ([]models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(m.apiKeys))
+	for _, key := range m.apiKeys {
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the API key with the given prefix
+func (m *MemoryStore) RevokeAPIKey(prefix string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range m.apiKeys {
+		if key.Prefix != prefix {
+			continue
+		}
+		if key.RevokedAt == nil {
+			key.RevokedAt = &at
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+// TouchAPIKey records that the API key with the given ID was used
+func (m *MemoryStore) TouchAPIKey(id uint, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id == 0 || int(id) > len(m.apiKeys) {
+		return ErrNotFound
+	}
+	m.apiKeys[id-1].LastUsedAt = &at
+	return nil
+}
+
+// CreateUser saves a new user and fills in its ID
+func (m *MemoryStore) CreateUser(user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.users {
+		if existing.Email == user.Email {
+			return ErrConflict
+		}
+	}
+
+	user.ID = uint(len(m.users) + 1)
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	stored := *user
+	m.users = append(m.users, &stored)
+	return nil
+}
+
+// FindUserByEmail retrieves the user registered with an email
+func (m *MemoryStore) FindUserByEmail(email string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// FindUserByID retrieves a user by its ID
+func (m *MemoryStore) FindUserByID(id uint) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if id == 0 || int(id) > len(m.users) {
+		return nil, ErrNotFound
+	}
+	copied := *m.users[id-1]
+	return &copied, nil
+}
+
+// CreateSession saves a new session and fills in its ID
+func (m *MemoryStore) CreateSession(session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[session.TokenHash]; ok {
+		return ErrConflict
+	}
+
+	m.nextSessionID++
+	session.ID = m.nextSessionID
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	stored := *session
+	m.sessions[stored.TokenHash] = &stored
+	return nil
+}
+
+// FindSessionByHash retrieves the session with the given token hash
+func (m *MemoryStore) FindSessionByHash(tokenHash string) (*models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[tokenHash]
+	if !ok || session.UserID == 0 || int(session.UserID) > len(m.users) {
+		return nil, ErrNotFound
+	}
+	copied := *session
+	copied.User = *m.users[session.UserID-1]
+	return &copied, nil
+}
+
+// DeleteSession removes the session with the given token hash
+func (m *MemoryStore) DeleteSession(tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, tokenHash)
+	return nil
+}
+
+// DeleteExpiredSessions removes every session that has expired at the given time
+func (m *MemoryStore) DeleteExpiredSessions(now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var removed int64
+	for tokenHash, session := range m.sessions {
+		if session.IsExpired(now) {
+			delete(m.sessions, tokenHash)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Ping always succeeds, there is nothing to reach
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op, the data simply goes away with the process
+func (m *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+)
+
+func TestMemoryStoreCreateAndFind(t *testing.T) {
+	m := NewMemoryStore()
+	key := "https://example.com/"
+
+	url := &models.URL{ShortCode: "abcd123", OriginalURL: key, NormalizedURL: key, DedupKey: &key}
+	if err := m.Create(url); err != nil {
+		t.Fatal(err)
+	}
+	if url.ID == 0 || url.CreatedAt.IsZero() {
+		t.Fatalf("Create left ID %d and CreatedAt %v unset", url.ID, url.CreatedAt)
+	}
+
+	found, err := m.FindByShortCode("abcd123")
+	if err != nil || found.ID != url.ID || found.OriginalURL != key {
+		t.Fatalf("FindByShortCode = %+v, %v, want the created link", found, err)
+	}
+	if found, err := m.FindByDedupKey(key); err != nil || found.ID != url.ID {
+		t.Fatalf("FindByDedupKey = %+v, %v, want the created link", found, err)
+	}
+
+	// Callers get copies, changing them leaves the store alone
+	found.OriginalURL = "https://example.org/"
+	if again, _ := m.FindByShortCode("abcd123"); again.OriginalURL != key {
+		t.Errorf("changing a found link changed the store to %q", again.OriginalURL)
+	}
+
+	if _, err := m.FindByShortCode("zzzz999"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByShortCode of an unknown code = %v, want ErrNotFound", err)
+	}
+	if _, err := m.FindByDedupKey("https://example.org/"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByDedupKey of an unknown key = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreCreateConflicts(t *testing.T) {
+	m := NewMemoryStore()
+	key := "https://example.com/"
+	if err := m.Create(&models.URL{ShortCode: "abcd123", DedupKey: &key}); err != nil {
+		t.Fatal(err)
+	}
+
+	other := "https://example.org/"
+	tests := []struct {
+		name string
+		url  *models.URL
+	}{
+		{"same short code", &models.URL{ShortCode: "abcd123", DedupKey: &other}},
+		{"same dedup key", &models.URL{ShortCode: "efgh456", DedupKey: &key}},
+	}
+	for _, tt := range tests {
+		if err := m.Create(tt.url); !errors.Is(err, ErrConflict) {
+			t.Errorf("%s: Create = %v, want ErrConflict", tt.name, err)
+		}
+	}
+
+	// Links without a dedup key, such as aliases, never clash on it
+	for _, code := range []string{"alias-1", "alias-2"} {
+		if err := m.Create(&models.URL{ShortCode: code}); err != nil {
+			t.Errorf("Create(%s) = %v", code, err)
+		}
+	}
+}
+
+func TestMemoryStoreAssignShortCodeReplacesPlaceholder(t *testing.T) {
+	m := NewMemoryStore()
+	url := &models.URL{ShortCode: "~placeholder", OriginalURL: "https://example.com/"}
+	if err := m.Create(url); err != nil {
+		t.Fatal(err)
+	}
+
+	key := "https://example.com/"
+	if err := m.AssignShortCode(url.ID, "0000001", &key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.FindByShortCode("~placeholder"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("placeholder still found after AssignShortCode: %v", err)
+	}
+	if taken, _ := m.IsShortCodeTaken("~placeholder"); taken {
+		t.Error("placeholder still taken after AssignShortCode")
+	}
+	found, err := m.FindByShortCode("0000001")
+	if err != nil || found.ID != url.ID || found.DedupKey == nil || *found.DedupKey != key {
+		t.Fatalf("FindByShortCode = %+v, %v, want the link with its dedup key", found, err)
+	}
+	if found, err := m.FindByDedupKey(key); err != nil || found.ShortCode != "0000001" {
+		t.Errorf("FindByDedupKey = %+v, %v, want the link under its new code", found, err)
+	}
+}
+
+func TestMemoryStoreAssignShortCodeConflicts(t *testing.T) {
+	m := NewMemoryStore()
+	key := "https://example.com/"
+	if err := m.Create(&models.URL{ShortCode: "taken01", DedupKey: &key}); err != nil {
+		t.Fatal(err)
+	}
+	url := &models.URL{ShortCode: "~placeholder"}
+	if err := m.Create(url); err != nil {
+		t.Fatal(err)
+	}
+
+	other := "https://example.org/"
+	tests := []struct {
+		name      string
+		id        uint
+		shortCode string
+		dedupKey  *string
+		want      error
+	}{
+		{"code of another link", url.ID, "taken01", &other, ErrConflict},
+		{"dedup key of another link", url.ID, "free001", &key, ErrConflict},
+		{"unknown link", 99, "free001", &other, ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := m.AssignShortCode(tt.id, tt.shortCode, tt.dedupKey); !errors.Is(err, tt.want) {
+			t.Errorf("%s: AssignShortCode = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// A refused assignment leaves the placeholder in place
+	if _, err := m.FindByShortCode("~placeholder"); err != nil {
+		t.Errorf("placeholder lost after refused assignments: %v", err)
+	}
+}
+
+// checkIndexes fails the test unless byID, byShortCode and byDedupKey hold
+// the same links under their current code and dedup key
+func checkIndexes(t *testing.T, m *MemoryStore) {
+	t.Helper()
+
+	dedupKeys := 0
+	for id, url := range m.byID {
+		if url.ID != id {
+			t.Errorf("byID[%d] holds link %d", id, url.ID)
+		}
+		if m.byShortCode[url.ShortCode] != url {
+			t.Errorf("link %d is not indexed under its code %q", id, url.ShortCode)
+		}
+		if url.DedupKey != nil {
+			dedupKeys++
+			if m.byDedupKey[*url.DedupKey] != url {
+				t.Errorf("link %d is not indexed under its dedup key %q", id, *url.DedupKey)
+			}
+		}
+	}
+	if len(m.byShortCode) != len(m.byID) || len(m.byDedupKey) != dedupKeys {
+		t.Errorf("%d codes and %d dedup keys indexed for %d links with %d dedup keys",
+			len(m.byShortCode), len(m.byDedupKey), len(m.byID), dedupKeys)
+	}
+}
+
+func TestMemoryStoreIndexesStayConsistent(t *testing.T) {
+	m := NewMemoryStore()
+	first, second := "https://example.com/1", "https://example.com/2"
+
+	deleted := &models.URL{ShortCode: "deleted", DedupKey: &first}
+	if err := m.Create(deleted); err != nil {
+		t.Fatal(err)
+	}
+	renamed := &models.URL{ShortCode: "~placeholder"}
+	if err := m.Create(renamed); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexes(t, m)
+
+	// A deleted link keeps its code but no longer its dedup key
+	if err := m.DeleteByShortCode("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexes(t, m)
+	if err := m.AssignShortCode(renamed.ID, "deleted", &second); !errors.Is(err, ErrConflict) {
+		t.Errorf("AssignShortCode to the code of a deleted link = %v, want ErrConflict", err)
+	}
+	if err := m.AssignShortCode(renamed.ID, "renamed", &first); err != nil {
+		t.Fatalf("AssignShortCode to the dedup key of a deleted link = %v", err)
+	}
+	checkIndexes(t, m)
+
+	// Purging leaves a tombstone that keeps the code taken for good
+	if _, err := m.PurgeDeleted(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexes(t, m)
+	if tomb, err := m.FindByShortCode("deleted"); err != nil || !tomb.IsPurged() {
+		t.Errorf("FindByShortCode of a purged link = %+v, %v, want its tombstone", tomb, err)
+	}
+	if err := m.AssignShortCode(deleted.ID, "other", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AssignShortCode of a purged link = %v, want ErrNotFound", err)
+	}
+	if err := m.AssignShortCode(renamed.ID, "deleted", &second); !errors.Is(err, ErrConflict) {
+		t.Errorf("AssignShortCode to a purged code = %v, want ErrConflict", err)
+	}
+	if err := m.AssignShortCode(renamed.ID, "renamed-2", &second); err != nil {
+		t.Fatalf("AssignShortCode = %v", err)
+	}
+	checkIndexes(t, m)
+
+	if _, err := m.FindByShortCode("renamed"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByShortCode of a replaced code = %v, want ErrNotFound", err)
+	}
+	if found, err := m.FindByDedupKey(second); err != nil || found.ID != renamed.ID {
+		t.Errorf("FindByDedupKey = %+v, %v, want the renamed link", found, err)
+	}
+	if _, err := m.FindByDedupKey(first); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByDedupKey of a replaced key = %v, want ErrNotFound", err)
+	}
+
+	// Sweeping expired links keeps the indexes in step too
+	expired := time.Now().Add(-time.Minute)
+	if err := m.Create(&models.URL{ShortCode: "expired", ExpiresAt: &expired}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.DeleteExpired(time.Now(), false); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexes(t, m)
+}
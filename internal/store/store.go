@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when no URL mapping matches the lookup
+	ErrNotFound = errors.New("record not found")
+
+	// ErrConflict is returned when a write would violate a unique constraint
+	ErrConflict = errors.New("record already exists")
+)
+
+// Store is everything the application persists
+type Store interface {
+	LinkStore
+	ClickStore
+	KeyStore
+	UserStore
+}
+
+// LinkStore persists URL mappings
+// Implementations must be safe for concurrent use
+type LinkStore interface {
+	// FindByShortCode retrieves a URL by its short code, deleted or not,
+	// so that the codes of deleted links are never mistaken for free ones
+	FindByShortCode(shortCode string) (*models.URL, error)
+
+	// FindByDedupKey retrieves the reusable URL with the given dedup key
+	// Links without a DedupKey, such as custom aliases, are never returned,
+	// and neither are deleted links
+	FindByDedupKey(dedupKey string) (*models.URL, error)
+
+	// ListByOwner returns the links of a user that haven't been deleted, newest first
+	ListByOwner(ownerID uint) ([]models.URL, error)
+
+	// Create saves a new URL mapping and fills in its ID
+	Create(url *models.URL) error
+
+	// AssignShortCode replaces the short code and dedup key of the URL with the given ID
+	// It returns ErrConflict when either is already used by another URL
+	AssignShortCode(id uint, shortCode string, dedupKey *string) error
+
+	// UpdateDestination points the link revision.LinkID at revision.NewURL and
+	// saves the revision, filling in its ID and number
+	// The link's dedup key is cleared, as it no longer matches the destination
+	// It returns ErrConflict when the link no longer points at revision.PreviousURL
+	UpdateDestination(revision *models.LinkRevision, normalizedURL string) error
+
+	// ListRevisions returns the revisions of a link with their editors, newest first
+	ListRevisions(linkID uint) ([]models.LinkRevision, error)
+
+	// DisableByShortCode disables the link with the given short code and
+	// clears its dedup key, so that shortening its URL again makes a new link
+	// It returns ErrNotFound when no link that isn't deleted has the code
+	DisableByShortCode(shortCode string, at time.Time, status int, reason string) error
+
+	// EnableByShortCode lets a disabled link redirect again
+	// It returns ErrNotFound when no link that isn't deleted has the code
+	EnableByShortCode(shortCode string) error
+
+	// DeleteByShortCode marks the URL mapping with the given short code deleted
+	// and clears its dedup key, the row keeps its short code for good
+	DeleteByShortCode(shortCode string) error
+
+	// PurgeDeleted clears the destination and removes the revisions of the
+	// links deleted at or before the given time, leaving tombstones that keep
+	// their short codes taken so they are never handed out again
+	// It returns the number of links purged
+	PurgeDeleted(before time.Time) (int64, error)
+
+	// IsShortCodeTaken checks if a short code already exists, deleted links included
+	IsShortCodeTaken(shortCode string) (bool, error)
+
+	// DeleteExpired deletes and purges every link that has expired at the
+	// given time, copying the links to the archive first when archive is true
+	// It returns the number of links removed
+	DeleteExpired(now time.Time, archive bool) (int64, error)
+
+	// Ping checks that the store is reachable and its schema is migrated
+	Ping(ctx context.Context) error
+
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// ClickStore persists click events and aggregates them per link
+// Implementations must be safe for concurrent use
+type ClickStore interface {
+	// RecordClicks saves a batch of click events
+	RecordClicks(clicks []models.Click) error
+
+	// ClickStats aggregates the clicks of a short link
+	// Clicks per day are limited to days on or after since, the top lists
+	// to the limit most frequent values
+	ClickStats(shortCode string, since time.Time, limit int) (*models.ClickStats, error)
+}
+
+// KeyStore persists the API keys of programmatic clients
+// Implementations must be safe for concurrent use
+type KeyStore interface {
+	// CreateAPIKey saves a new API key and fills in its ID
+	CreateAPIKey(key *models.APIKey) error
+
+	// FindAPIKeyByHash retrieves the API key with the given hash, revoked or not
+	FindAPIKeyByHash(keyHash string) (*models.APIKey, error)
+
+	// ListAPIKeys returns every API key, oldest first
+	ListAPIKeys() ([]models.APIKey, error)
+
+	// RevokeAPIKey revokes the API key with the given prefix
+	// Revoking a key twice keeps the time of the first revocation
+	RevokeAPIKey(prefix string, at time.Time) error
+
+	// TouchAPIKey records that the API key with the given ID was used
+	TouchAPIKey(id uint, at time.Time) error
+}
+
+// UserStore persists user accounts and their login sessions
+// Implementations must be safe for concurrent use
+type UserStore interface {
+	// CreateUser saves a new user and fills in its ID
+	// It returns ErrConflict when the email is already registered
+	CreateUser(user *models.User) error
+
+	// FindUserByEmail retrieves the user registered with an email
+	FindUserByEmail(email string) (*models.User, error)
+
+	// FindUserByID retrieves a user by its ID
+	FindUserByID(id uint) (*models.User, error)
+
+	// CreateSession saves a new session and fills in its ID
+	CreateSession(session *models.Session) error
+
+	// FindSessionByHash retrieves the session with the given token hash, expired or not
+	FindSessionByHash(tokenHash string) (*models.Session, error)
+
+	// DeleteSession removes the session with the given token hash
+	DeleteSession(tokenHash string) error
+
+	// DeleteExpiredSessions removes every session that has expired at the given time
+	// It returns the number of sessions removed
+	DeleteExpiredSessions(now time.Time) (int64, error)
+}
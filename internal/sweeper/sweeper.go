@@ -0,0 +1,94 @@
+package sweeper
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+// housekeepingInterval is how often a sweeper that leaves expired links alone runs
+const housekeepingInterval = time.Hour
+
+// Sweeper periodically removes expired links and login sessions from the
+// store, and purges deleted links once their retention window has passed
+type Sweeper struct {
+	store     store.Store
+	interval  time.Duration
+	archive   bool
+	retention time.Duration
+	now       func() time.Time
+
+	// sweepExpired is false when expired links are left for good
+	sweepExpired bool
+}
+
+// New creates a sweeper that runs every interval
+// When archive is true expired links are archived instead of purged, deleted
+// links are purged retention after they were deleted
+// An interval of 0 leaves expired links alone, the sweeper then still removes
+// expired sessions and purges deleted links every housekeepingInterval
+func New(linkStore store.Store, interval time.Duration, archive bool, retention time.Duration) *Sweeper {
+	s := &Sweeper{
+		store:        linkStore,
+		interval:     interval,
+		archive:      archive,
+		retention:    retention,
+		now:          time.Now,
+		sweepExpired: interval > 0,
+	}
+	if !s.sweepExpired {
+		s.interval = housekeepingInterval
+	}
+	return s
+}
+
+// Run sweeps once immediately and then on every tick until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep removes the links and sessions that have expired by now, and purges
+// the links deleted more than the retention window ago
+func (s *Sweeper) Sweep() {
+	now := s.now()
+	if _, err := s.store.DeleteExpiredSessions(now); err != nil {
+		log.Printf("Failed to sweep expired sessions: %v", err)
+	}
+
+	if purged, err := s.store.PurgeDeleted(now.Add(-s.retention)); err != nil {
+		log.Printf("Failed to purge deleted links: %v", err)
+	} else if purged > 0 {
+		log.Printf("Purged %d deleted links", purged)
+	}
+
+	if !s.sweepExpired {
+		return
+	}
+
+	removed, err := s.store.DeleteExpired(now, s.archive)
+	if err != nil {
+		log.Printf("Failed to sweep expired links: %v", err)
+		return
+	}
+
+	if removed > 0 {
+		action := "Purged"
+		if s.archive {
+			action = "Archived"
+		}
+		log.Printf("%s %d expired links", action, removed)
+	}
+}
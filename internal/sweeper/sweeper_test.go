@@ -0,0 +1,152 @@
+package sweeper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ItsDobiel/URLShortener/internal/models"
+	"github.com/ItsDobiel/URLShortener/internal/store"
+)
+
+// newTestSweeper creates a sweeper on the given store whose clock reads *now
+func newTestSweeper(links *store.MemoryStore, archive bool, retention time.Duration, now *time.Time) *Sweeper {
+	s := New(links, time.Hour, archive, retention)
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func createLink(t *testing.T, links *store.MemoryStore, shortCode string, expiresAt *time.Time) {
+	t.Helper()
+
+	url := &models.URL{ShortCode: shortCode, OriginalURL: "https://example.com/" + shortCode, ExpiresAt: expiresAt}
+	if err := links.Create(url); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepExpiredLinks(t *testing.T) {
+	for _, archive := range []bool{false, true} {
+		links := store.NewMemoryStore()
+		now := time.Now()
+		soon, later := now.Add(time.Hour), now.Add(3*time.Hour)
+		createLink(t, links, "forever", nil)
+		createLink(t, links, "expires-soon", &soon)
+		createLink(t, links, "expires-later", &later)
+
+		s := newTestSweeper(links, archive, time.Hour, &now)
+		s.Sweep()
+		for _, code := range []string{"forever", "expires-soon", "expires-later"} {
+			if _, err := links.FindByShortCode(code); err != nil {
+				t.Errorf("archive %v: %s swept before it expired: %v", archive, code, err)
+			}
+		}
+
+		now = now.Add(2 * time.Hour)
+		s.Sweep()
+		if tomb, err := links.FindByShortCode("expires-soon"); err != nil || !tomb.IsPurged() {
+			t.Errorf("archive %v: expired link = %+v, %v, want its tombstone", archive, tomb, err)
+		}
+		if taken, _ := links.IsShortCodeTaken("expires-soon"); !taken {
+			t.Errorf("archive %v: code of a swept link is free again", archive)
+		}
+		for _, code := range []string{"forever", "expires-later"} {
+			if live, err := links.FindByShortCode(code); err != nil || live.IsDeleted() {
+				t.Errorf("archive %v: live link %s = %+v, %v", archive, code, live, err)
+			}
+		}
+
+		archived := links.Archived()
+		if !archive {
+			if len(archived) != 0 {
+				t.Errorf("purging sweeper archived %+v", archived)
+			}
+			continue
+		}
+		if len(archived) != 1 || archived[0].ShortCode != "expires-soon" || !archived[0].ArchivedAt.Equal(now) {
+			t.Errorf("archived %+v, want expires-soon archived at the sweep", archived)
+		}
+	}
+}
+
+func TestSweepPurgesDeletedLinksAfterRetention(t *testing.T) {
+	links := store.NewMemoryStore()
+	createLink(t, links, "deleted", nil)
+	createLink(t, links, "kept", nil)
+	if err := links.DeleteByShortCode("deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	retention := 24 * time.Hour
+	now := time.Now().Add(time.Hour)
+	s := newTestSweeper(links, false, retention, &now)
+	s.Sweep()
+	if deleted, _ := links.FindByShortCode("deleted"); deleted.IsPurged() {
+		t.Error("deleted link purged within its retention window")
+	}
+
+	// Past the window only a tombstone is left, keeping the code taken
+	now = now.Add(retention)
+	s.Sweep()
+	if tomb, err := links.FindByShortCode("deleted"); err != nil || !tomb.IsPurged() {
+		t.Errorf("deleted link past its retention window = %+v, %v, want its tombstone", tomb, err)
+	}
+	if taken, _ := links.IsShortCodeTaken("deleted"); !taken {
+		t.Error("code of a purged link is free again")
+	}
+	if kept, err := links.FindByShortCode("kept"); err != nil || kept.IsDeleted() {
+		t.Errorf("live link = %+v, %v", kept, err)
+	}
+}
+
+func TestSweepExpiredSessions(t *testing.T) {
+	links := store.NewMemoryStore()
+	user := &models.User{Email: "user@example.com", PasswordHash: "hash"}
+	if err := links.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	sessions := map[string]time.Time{
+		"expired": now.Add(-time.Minute),
+		"live":    now.Add(time.Hour),
+	}
+	for tokenHash, expiresAt := range sessions {
+		if err := links.CreateSession(&models.Session{TokenHash: tokenHash, UserID: user.ID, ExpiresAt: expiresAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newTestSweeper(links, false, time.Hour, &now).Sweep()
+	if _, err := links.FindSessionByHash("expired"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expired session still found after a sweep: %v", err)
+	}
+	if _, err := links.FindSessionByHash("live"); err != nil {
+		t.Errorf("live session swept: %v", err)
+	}
+}
+
+func TestSweepWithoutExpiryInterval(t *testing.T) {
+	links := store.NewMemoryStore()
+	now := time.Now().Add(time.Hour)
+	expired := now.Add(-time.Minute)
+	createLink(t, links, "expired", &expired)
+	createLink(t, links, "deleted", nil)
+	if err := links.DeleteByShortCode("deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(links, 0, false, 0)
+	s.now = func() time.Time { return now }
+	if s.interval != housekeepingInterval {
+		t.Errorf("interval = %s, want %s", s.interval, housekeepingInterval)
+	}
+
+	s.Sweep()
+	if kept, err := links.FindByShortCode("expired"); err != nil || kept.IsDeleted() {
+		t.Errorf("expired link = %+v, %v, want it kept", kept, err)
+	}
+	if tomb, err := links.FindByShortCode("deleted"); err != nil || !tomb.IsPurged() {
+		t.Errorf("deleted link = %+v, %v, want it purged", tomb, err)
+	}
+}
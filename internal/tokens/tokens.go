@@ -0,0 +1,14 @@
+package tokens
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Hash returns the hex SHA-256 of a token, the form API keys and session
+// tokens are stored in
+// Tokens are long and random, so a fast hash is enough to keep them safe at rest
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
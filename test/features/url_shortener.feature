@@ -46,6 +46,24 @@ Feature: URL Shortener
       | HTTPS://GiThUb.CoM/ItsDobiel/URLShortener | https://github.com/ItsDobiel/URLShortener |
       | httpS://docs.PODMAN.io/en/latest          | https://docs.podman.io/en/latest          |
 
+  Scenario Outline: URL normalization - equivalent URLs
+    When I enter the URL "<url_variant1>"
+    And I submit the form
+    Then I should see a shortened URL
+    When I enter the URL "<url_variant2>"
+    And I submit the form
+    Then I should receive the same short code as before
+
+    Examples:
+      | url_variant1                                                | url_variant2                                |
+      | https://go.dev:443/doc/effective_go                         | https://go.dev/doc/effective_go             |
+      | https://pkg.go.dev/search?q=godog&m=package                 | https://pkg.go.dev/search?m=package&q=godog |
+      | https://go.dev/doc/./tutorial/../faq                        | https://go.dev/doc/faq                      |
+      | https://en.wikipedia.org/wiki/%7eTilde                      | https://en.wikipedia.org/wiki/~Tilde        |
+      | https://bücher.example/katalog                              | https://xn--bcher-kva.example/katalog       |
+      | https://go.dev/play/?utm_source=newsletter&utm_medium=email | https://go.dev/play/                        |
+      | https://cucumber.io/tools?fbclid=IwAR0abc                   | https://cucumber.io/tools                   |
+
   Scenario Outline: Duplicate URL returns same short code
     When I enter the URL "<url>"
     And I submit the form
@@ -70,6 +88,41 @@ Feature: URL Shortener
       | https://example.com/search?q=Price%20of%20US%20%24&page=2#results  |
       | https://example.com/post?uuid=c3191902-bbef-4434-b043-e2cceedcc227 |
 
+  Scenario Outline: Shorten a URL under a custom alias
+    When I enter the URL "<url>"
+    And I enter the alias "<alias>"
+    And I submit the form
+    Then I should see a success message
+    And I should see a shortened URL
+    And the short code should be "<alias>"
+
+    Examples:
+      | url                                      | alias       |
+      | https://cucumber.io/docs/gherkin/        | gherkin-doc |
+      | https://github.com/cucumber/godog#readme | godog_2025  |
+
+  Scenario: Reject a custom alias that is already taken
+    When I enter the URL "https://go.dev/doc/"
+    And I enter the alias "go-docs"
+    And I submit the form
+    Then I should see a shortened URL
+    When I enter the URL "https://go.dev/ref/spec"
+    And I enter the alias "go-docs"
+    And I submit the form
+    Then I should see an error message
+
+  Scenario Outline: Reject a reserved custom alias
+    When I enter the URL "https://go.dev/blog/"
+    And I enter the alias "<alias>"
+    And I submit the form
+    Then I should see an error message
+
+    Examples:
+      | alias   |
+      | static  |
+      | shorten |
+      | admin   |
+
   Scenario Outline: Reject invalid URLs
     When I enter the URL "<invalid_url>"
     And I submit the form
@@ -85,6 +138,64 @@ Feature: URL Shortener
       | /invalid@chars!         |
       | /short code with spaces |
 
+  Scenario Outline: Reject destinations on internal networks
+    When I enter the URL "<internal_url>"
+    And I submit the form
+    Then I should see an error message
+
+    Examples:
+      | internal_url                            |
+      | http://localhost:8080/admin             |
+      | http://127.0.0.1/                       |
+      | http://169.254.169.254/latest/meta-data |
+      | http://10.0.0.1/                        |
+      | http://192.168.1.1/                     |
+      | http://[::1]/                           |
+      | http://2130706433/                      |
+      | http://0177.0.0.1/                      |
+
+  Scenario: Reject links to the shortener itself
+    When I enter the URL "https://github.com/cucumber/godog"
+    And I submit the form
+    Then I should see a shortened URL
+    When I enter the short URL as the URL
+    And I submit the form
+    Then I should see an error message
+
+  Scenario: Links shortened while logged in are listed on my links page
+    When I register as "alice@example.com" with the password "correct horse"
+    And I enter the URL "https://cucumber.io/docs/gherkin/reference/"
+    And I submit the form
+    Then I should see a shortened URL
+    And my links should include the short code
+    When I log out
+    Then my links page should ask me to log in
+
+  Scenario: Change the destination of my link and restore it
+    When I register as "bob@example.com" with the password "correct horse"
+    And I enter the URL "https://cucumber.io/docs/gherkin/"
+    And I submit the form
+    Then I should see a shortened URL
+    When I change the destination of my link to "https://cucumber.io/docs/bdd/"
+    Then my link should point to "https://cucumber.io/docs/bdd/"
+    And the shortned URL must redirect me to "https://cucumber.io/docs/bdd/"
+    When I restore the original destination of my link
+    Then my link should point to "https://cucumber.io/docs/gherkin/"
+    When I log out
+    Then my links page should ask me to log in
+
+  Scenario: A disabled link no longer redirects
+    When I register as "carol@example.com" with the password "correct horse"
+    And I enter the URL "https://cucumber.io/docs/guides/"
+    And I submit the form
+    Then I should see a shortened URL
+    When I disable my link
+    And I open the short URL
+    Then I should see that the link has been disabled
+    When I am on the home page
+    And I log out
+    Then my links page should ask me to log in
+
   Scenario Outline: Accessing non-existent short code
     When I navigate to "<path>"
     Then I should see an error page
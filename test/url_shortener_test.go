@@ -137,6 +137,9 @@ func buildApplication() error {
 
 func startServer() error {
 	os.Setenv("TEMPLATES_DIR", "../templates")
+	// Every scenario shortens from localhost, the limits would soon answer 429
+	os.Setenv("SHORTEN_RATE_LIMIT", "0")
+	os.Setenv("REDIRECT_RATE_LIMIT", "0")
 
 	testCtx.serverCmd = exec.Command("./server")
 	testCtx.serverCmd.Dir = "."
@@ -160,10 +163,13 @@ func stopServer() {
 	os.Remove("./server")
 	cfg, err := config.Load()
 	if err != nil {
-		fmt.Errorf("Failed to load configuration: %v", err)
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		return
 	}
 	os.RemoveAll(cfg.DatabasePath)
 	os.Setenv("TEMPLATES_DIR", "")
+	os.Unsetenv("SHORTEN_RATE_LIMIT")
+	os.Unsetenv("REDIRECT_RATE_LIMIT")
 }
 
 func initializeScenario(ctx *godog.ScenarioContext) {
@@ -185,6 +191,8 @@ func initializeScenario(ctx *godog.ScenarioContext) {
 	ctx.Step(`^the URL shortener service is running$`, stepServiceIsRunning)
 	ctx.Step(`^I am on the home page$`, stepOnHomePage)
 	ctx.Step(`^I enter the URL "([^"]*)"$`, stepEnterURL)
+	ctx.Step(`^I enter the alias "([^"]*)"$`, stepEnterAlias)
+	ctx.Step(`^I enter the short URL as the URL$`, stepEnterShortURL)
 	ctx.Step(`^I submit the form$`, stepSubmitForm)
 	ctx.Step(`^I should see a success message$`, stepSeeSuccessMessage)
 	ctx.Step(`^I should see a shortened URL$`, stepSeeShortenedURL)
@@ -197,6 +205,17 @@ func initializeScenario(ctx *godog.ScenarioContext) {
 	ctx.Step(`^the error should indicate the short code was not found$`, stepErrorNotFound)
 	ctx.Step(`^the short code should be alphanumeric with allowed characters$`, stepShortCodeAlphanumeric)
 	ctx.Step(`^the short code length should match the configured length$`, stepShortCodeLength)
+	ctx.Step(`^the short code should be "([^"]*)"$`, stepShortCodeIs)
+	ctx.Step(`^I register as "([^"]*)" with the password "([^"]*)"$`, stepRegister)
+	ctx.Step(`^my links should include the short code$`, stepMyLinksIncludeShortCode)
+	ctx.Step(`^I log out$`, stepLogOut)
+	ctx.Step(`^my links page should ask me to log in$`, stepMyLinksAsksToLogIn)
+	ctx.Step(`^I change the destination of my link to "([^"]*)"$`, stepChangeDestination)
+	ctx.Step(`^I restore the original destination of my link$`, stepRestoreOriginalDestination)
+	ctx.Step(`^my link should point to "([^"]*)"$`, stepLinkPointsTo)
+	ctx.Step(`^I disable my link$`, stepDisableMyLink)
+	ctx.Step(`^I open the short URL$`, stepOpenShortURL)
+	ctx.Step(`^I should see that the link has been disabled$`, stepSeeLinkDisabled)
 }
 
 func newWebDriver() (selenium.WebDriver, error) {
@@ -259,6 +278,26 @@ func stepEnterURL(url string) error {
 	return err
 }
 
+func stepEnterAlias(alias string) error {
+	fmt.Printf("   Entering alias: %s\n", alias)
+
+	aliasInput, err := testCtx.webDriver.FindElement(selenium.ByID, "alias")
+	if err != nil {
+		return fmt.Errorf("alias input not found: %w", err)
+	}
+
+	aliasInput.Clear()
+	return aliasInput.SendKeys(alias)
+}
+
+func stepEnterShortURL() error {
+	if testCtx.lastShortCode == "" {
+		return fmt.Errorf("no short code found")
+	}
+
+	return stepEnterURL(testCtx.baseURL + "/" + testCtx.lastShortCode)
+}
+
 func stepSubmitForm() error {
 	fmt.Println("   Clicking submit button...")
 
@@ -473,3 +512,186 @@ func stepShortCodeLength() error {
 	fmt.Printf("   Length correct: %d chars\n", actualLength)
 	return nil
 }
+
+func stepShortCodeIs(expected string) error {
+	fmt.Println("   Checking short code matches the alias...")
+
+	if testCtx.lastShortCode != expected {
+		return fmt.Errorf("expected short code '%s', got '%s'", expected, testCtx.lastShortCode)
+	}
+
+	fmt.Printf("   Short code is the alias: %s\n", testCtx.lastShortCode)
+	return nil
+}
+
+func stepRegister(email, password string) error {
+	fmt.Printf("   Registering as %s...\n", email)
+	if err := testCtx.webDriver.Get(testCtx.baseURL + "/register"); err != nil {
+		return err
+	}
+
+	emailInput, err := testCtx.webDriver.FindElement(selenium.ByID, "email")
+	if err != nil {
+		return fmt.Errorf("email input not found: %w", err)
+	}
+	if err := emailInput.SendKeys(email); err != nil {
+		return err
+	}
+
+	passwordInput, err := testCtx.webDriver.FindElement(selenium.ByID, "password")
+	if err != nil {
+		return fmt.Errorf("password input not found: %w", err)
+	}
+	if err := passwordInput.SendKeys(password); err != nil {
+		return err
+	}
+
+	if err := stepSubmitForm(); err != nil {
+		return err
+	}
+
+	if _, err := testCtx.webDriver.FindElement(selenium.ByID, "logout"); err != nil {
+		return fmt.Errorf("not logged in after registering: %w", err)
+	}
+	return stepOnHomePage()
+}
+
+func stepMyLinksIncludeShortCode() error {
+	fmt.Println("   Checking my links page...")
+	if testCtx.lastShortCode == "" {
+		return fmt.Errorf("no short code found")
+	}
+
+	if err := testCtx.webDriver.Get(testCtx.baseURL + "/links"); err != nil {
+		return err
+	}
+
+	items, _ := testCtx.webDriver.FindElements(selenium.ByCSSSelector, "#links li")
+	for _, item := range items {
+		code, _ := item.GetAttribute("data-short-code")
+		if code == testCtx.lastShortCode {
+			fmt.Printf("   Link %s listed!\n", code)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("short code %q not listed on my links page", testCtx.lastShortCode)
+}
+
+func stepLogOut() error {
+	fmt.Println("   Logging out...")
+
+	button, err := testCtx.webDriver.FindElement(selenium.ByID, "logout")
+	if err != nil {
+		return fmt.Errorf("logout button not found: %w", err)
+	}
+	return button.Click()
+}
+
+func stepMyLinksAsksToLogIn() error {
+	fmt.Println("   Checking my links page requires logging in...")
+	if err := testCtx.webDriver.Get(testCtx.baseURL + "/links"); err != nil {
+		return err
+	}
+
+	currentURL, err := testCtx.webDriver.CurrentURL()
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(currentURL, "/login") {
+		return fmt.Errorf("expected to be sent to the login page, got %s", currentURL)
+	}
+	return nil
+}
+
+func openMyLink() error {
+	if testCtx.lastShortCode == "" {
+		return fmt.Errorf("no short code found")
+	}
+	return testCtx.webDriver.Get(testCtx.baseURL + "/links/" + testCtx.lastShortCode)
+}
+
+func stepChangeDestination(url string) error {
+	fmt.Printf("   Changing destination to: %s\n", url)
+	if err := openMyLink(); err != nil {
+		return err
+	}
+
+	urlInput, err := testCtx.webDriver.FindElement(selenium.ByID, "url")
+	if err != nil {
+		return fmt.Errorf("URL input not found: %w", err)
+	}
+	urlInput.Clear()
+	if err := urlInput.SendKeys(url); err != nil {
+		return err
+	}
+
+	return stepSubmitForm()
+}
+
+func stepRestoreOriginalDestination() error {
+	fmt.Println("   Restoring original destination...")
+	if err := openMyLink(); err != nil {
+		return err
+	}
+
+	button, err := testCtx.webDriver.FindElement(selenium.ByCSSSelector, `#history li[data-revision="0"] button`)
+	if err != nil {
+		return fmt.Errorf("restore button not found: %w", err)
+	}
+	return button.Click()
+}
+
+func stepLinkPointsTo(url string) error {
+	fmt.Println("   Checking link destination...")
+	if err := openMyLink(); err != nil {
+		return err
+	}
+
+	destination, err := testCtx.webDriver.FindElement(selenium.ByID, "destination")
+	if err != nil {
+		return fmt.Errorf("destination not found: %w", err)
+	}
+	text, err := destination.Text()
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(text) != url {
+		return fmt.Errorf("expected the link to point to %q, got %q", url, text)
+	}
+
+	fmt.Println("   Destination matches!")
+	return nil
+}
+
+func stepDisableMyLink() error {
+	fmt.Println("   Disabling my link...")
+	if err := testCtx.webDriver.Get(testCtx.baseURL + "/links"); err != nil {
+		return err
+	}
+
+	selector := fmt.Sprintf(`#links li[data-short-code="%s"] form[action$="/disable"] button`, testCtx.lastShortCode)
+	button, err := testCtx.webDriver.FindElement(selenium.ByCSSSelector, selector)
+	if err != nil {
+		return fmt.Errorf("disable button not found: %w", err)
+	}
+	return button.Click()
+}
+
+func stepOpenShortURL() error {
+	if testCtx.lastShortCode == "" {
+		return fmt.Errorf("no short code found")
+	}
+	return stepNavigateTo("/" + testCtx.lastShortCode)
+}
+
+func stepSeeLinkDisabled() error {
+	fmt.Println("   Checking the link is disabled...")
+
+	if _, err := testCtx.webDriver.FindElement(selenium.ByID, "disabled"); err != nil {
+		return fmt.Errorf("disabled link page not displayed: %w", err)
+	}
+
+	fmt.Println("   Link disabled page shown!")
+	return nil
+}